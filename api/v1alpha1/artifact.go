@@ -38,6 +38,10 @@ type Artifact struct {
 	// +optional
 	Revision string `json:"revision"`
 
+	// Checksum is the SHA256 checksum of the artifact file.
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+
 	// LastUpdateTime is the timestamp corresponding to the last
 	// update of this artifact.
 	// +required
@@ -0,0 +1,190 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BucketSpec defines the desired state of an S3 compatible bucket
+type BucketSpec struct {
+	// The bucket endpoint address, a host with an optional port.
+	// +required
+	Endpoint string `json:"endpoint"`
+
+	// The bucket name.
+	// +required
+	BucketName string `json:"bucketName"`
+
+	// The bucket region, defaults to 'us-east-1'.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// Insecure allows connecting to a non-TLS S3 HTTP endpoint.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// The object key prefix, only objects with keys starting with
+	// the prefix are included in the artifact.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// The secret name containing the bucket accesskey and secretkey.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// The interval at which to check for bucket updates.
+	// +required
+	Interval metav1.Duration `json:"interval"`
+
+	// The timeout for download operations, default ('20s').
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Ignore excludes the objects matching the patterns from the artifact,
+	// in the .gitignore format. The patterns of the .sourceignore object
+	// found in the bucket root are applied in addition to these.
+	// +optional
+	Ignore *string `json:"ignore,omitempty"`
+}
+
+// BucketStatus defines the observed state of a bucket
+type BucketStatus struct {
+	// +optional
+	Conditions []SourceCondition `json:"conditions,omitempty"`
+
+	// URL is the download link for the artifact output of the last Bucket sync.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Artifact represents the output of the last successful Bucket sync.
+	// +optional
+	Artifact *Artifact `json:"artifact,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the artifact was
+	// produced from.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+const (
+	// BucketOperationSucceedReason represents the fact that the bucket listing
+	// and download operations succeeded.
+	BucketOperationSucceedReason string = "BucketOperationSucceed"
+
+	// BucketOperationFailedReason represents the fact that the bucket listing
+	// or download operations failed.
+	BucketOperationFailedReason string = "BucketOperationFailed"
+)
+
+func BucketReady(bucket Bucket, artifact Artifact, url, reason, message string) Bucket {
+	bucket.Status.Conditions = []SourceCondition{
+		{
+			Type:               ReadyCondition,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		},
+	}
+	bucket.Status.URL = url
+	bucket.Status.ObservedGeneration = bucket.Generation
+
+	if bucket.Status.Artifact != nil {
+		if bucket.Status.Artifact.Path != artifact.Path ||
+			bucket.Status.Artifact.Checksum != artifact.Checksum {
+			bucket.Status.Artifact = &artifact
+		}
+	} else {
+		bucket.Status.Artifact = &artifact
+	}
+
+	return bucket
+}
+
+func BucketNotReady(bucket Bucket, reason, message string) Bucket {
+	bucket.Status.Conditions = []SourceCondition{
+		{
+			Type:               ReadyCondition,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		},
+	}
+	return bucket
+}
+
+func BucketReadyMessage(bucket Bucket) string {
+	for _, condition := range bucket.Status.Conditions {
+		if condition.Type == ReadyCondition {
+			return condition.Message
+		}
+	}
+	return ""
+}
+
+// GetArtifact returns the latest artifact from the source
+// if present in the status sub-resource.
+func (in *Bucket) GetArtifact() *Artifact {
+	return in.Status.Artifact
+}
+
+// GetInterval returns the interval at which the source is updated.
+func (in *Bucket) GetInterval() metav1.Duration {
+	return in.Spec.Interval
+}
+
+// GetTimeout returns the configured timeout or the default.
+func (in *Bucket) GetTimeout() metav1.Duration {
+	if in.Spec.Timeout != nil {
+		return *in.Spec.Timeout
+	}
+	return metav1.Duration{Duration: 20 * time.Second}
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.spec.endpoint`
+// +kubebuilder:printcolumn:name="Bucket",type=string,JSONPath=`.spec.bucketName`
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description=""
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
+
+// Bucket is the Schema for the buckets API
+type Bucket struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BucketSpec   `json:"spec,omitempty"`
+	Status BucketStatus `json:"status,omitempty"`
+}
+
+// BucketList contains a list of Bucket
+// +kubebuilder:object:root=true
+type BucketList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Bucket `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Bucket{}, &BucketList{})
+}
@@ -23,19 +23,26 @@ import (
 
 // GitRepositorySpec defines the desired state of a Git repository.
 type GitRepositorySpec struct {
-	// The repository URL, can be a HTTP or SSH address.
-	// +kubebuilder:validation:Pattern="^(http|https|ssh)://"
+	// The repository URL, can be a HTTP, SSH or git address. SSH addresses
+	// can use the scp-like syntax, e.g. git@github.com:org/repo.git.
+	// +kubebuilder:validation:Pattern="^((http|https|ssh|git)://|[a-zA-Z0-9._-]+@[a-zA-Z0-9._-]+:)"
 	// +required
 	URL string `json:"url"`
 
 	// The secret name containing the Git credentials.
 	// For HTTPS repositories the secret must contain username and password
-	// fields.
+	// fields, a bearerToken field, or githubAppID, githubAppInstallationID
+	// and githubAppPrivateKey fields, and can contain caFile, certFile and
+	// keyFile fields for TLS.
 	// For SSH repositories the secret must contain identity, identity.pub and
-	// known_hosts fields.
+	// known_hosts fields, and a password field if the identity is encrypted.
 	// +optional
 	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
 
+	// SSH restricts the algorithms negotiated with SSH repositories.
+	// +optional
+	SSH *GitSSHConfig `json:"ssh,omitempty"`
+
 	// The interval at which to check for repository updates.
 	// +required
 	Interval metav1.Duration `json:"interval"`
@@ -48,6 +55,90 @@ type GitRepositorySpec struct {
 	// Verify OpenPGP signature for the commit that HEAD points to.
 	// +optional
 	Verification *GitRepositoryVerification `json:"verify,omitempty"`
+
+	// Ignore overrides the default set of excluded patterns, in the
+	// .gitignore format. The patterns of the .sourceignore file found
+	// in the repository root are applied in addition to these.
+	// +optional
+	Ignore *string `json:"ignore,omitempty"`
+
+	// RecurseSubmodules enables the checkout of the submodules, and of
+	// their nested submodules, at the commits recorded in the repository.
+	// +optional
+	RecurseSubmodules bool `json:"recurseSubmodules,omitempty"`
+
+	// SubmoduleSecretRefs holds the credentials of the hosts serving
+	// submodules. Submodules hosted elsewhere are cloned with the
+	// SecretRef credentials if they share the repository host, and
+	// anonymously otherwise.
+	// +optional
+	SubmoduleSecretRefs []GitHostSecretRef `json:"submoduleSecretRefs,omitempty"`
+
+	// Include the artifacts of other GitRepositories in the artifact of
+	// this repository.
+	// +optional
+	Include []GitRepositoryInclude `json:"include,omitempty"`
+}
+
+// GitSSHConfig defines the algorithms negotiated with an SSH server, in
+// order of preference. The SSH client defaults are used when empty.
+type GitSSHConfig struct {
+	// HostKeyAlgorithms are the accepted host key algorithms, e.g.
+	// ssh-ed25519 or rsa-sha2-512.
+	// +optional
+	HostKeyAlgorithms []string `json:"hostKeyAlgorithms,omitempty"`
+
+	// KexAlgorithms are the accepted key exchange algorithms, e.g.
+	// curve25519-sha256@libssh.org.
+	// +optional
+	KexAlgorithms []string `json:"kexAlgorithms,omitempty"`
+
+	// Ciphers are the accepted ciphers, e.g. aes256-gcm@openssh.com.
+	// +optional
+	Ciphers []string `json:"ciphers,omitempty"`
+}
+
+// GitRepositoryInclude defines a GitRepository whose artifact is copied
+// into the artifact of the including repository.
+type GitRepositoryInclude struct {
+	// The name of the GitRepository, in the same namespace.
+	// +required
+	GitRepositoryRef corev1.LocalObjectReference `json:"repository"`
+
+	// The path to copy from the included artifact, defaults to the
+	// artifact root.
+	// +optional
+	FromPath string `json:"fromPath,omitempty"`
+
+	// The path to copy the content to, relative to the repository root,
+	// defaults to the name of the included repository.
+	// +optional
+	ToPath string `json:"toPath,omitempty"`
+}
+
+// GetFromPath returns the path to copy from the included artifact.
+func (in *GitRepositoryInclude) GetFromPath() string {
+	return in.FromPath
+}
+
+// GetToPath returns the path to copy the included artifact to.
+func (in *GitRepositoryInclude) GetToPath() string {
+	if in.ToPath == "" {
+		return in.GitRepositoryRef.Name
+	}
+	return in.ToPath
+}
+
+// GitHostSecretRef defines the credentials used for a Git host.
+type GitHostSecretRef struct {
+	// The host name, as found in the submodule URLs.
+	// +required
+	Host string `json:"host"`
+
+	// The secret name containing the Git credentials, in the same format
+	// as the GitRepository secret.
+	// +required
+	SecretRef corev1.LocalObjectReference `json:"secretRef"`
 }
 
 // GitRepositoryRef defines the git ref used for pull and checkout operations.
@@ -64,19 +155,86 @@ type GitRepositoryRef struct {
 	// +optional
 	SemVer string `json:"semver"`
 
+	// The prerelease policy of the semver expression, 'include' selects
+	// the matching prereleases, 'exclude' ignores them, and
+	// 'include-only-for-range' selects them only when the expression
+	// holds a prerelease of the same version. Defaults to 'include'.
+	// +kubebuilder:validation:Enum=include;exclude;include-only-for-range
+	// +optional
+	Prerelease string `json:"prerelease,omitempty"`
+
+	// The regular expression the tags must match to be selected by the
+	// semver expression. The version is read from the first capture group,
+	// or from the whole match, e.g. ^app-v(.*)$ for app-v1.2.3 tags.
+	// +optional
+	TagPattern string `json:"tagPattern,omitempty"`
+
+	// The policy ordering the tags to select the latest one, for tags
+	// that are not semver. Semver takes precedence over the policy, the
+	// policy takes precedence over tag.
+	// +optional
+	Policy *GitTagPolicy `json:"policy,omitempty"`
+
+	// The fully qualified git reference to checkout, e.g.
+	// refs/pull/123/head, takes precedence over semver.
+	// +kubebuilder:validation:Pattern="^refs/"
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// The pattern of the git branches to checkout, e.g. preview/*, each
+	// matching branch gets its own artifact. When set, the other fields
+	// of the reference are ignored.
+	// +optional
+	BranchPattern string `json:"branchPattern,omitempty"`
+
 	// The git commit sha to checkout, if specified tag filters will be
 	// ignored.
 	// +optional
 	Commit string `json:"commit"`
 }
 
-// GitRepositoryVerification defines the OpenPGP signature verification process.
+// GitTagPolicy defines how the latest tag is selected.
+type GitTagPolicy struct {
+	// The order of the tags, the last one is selected. 'alphabetical'
+	// and 'numerical' order the tag names, 'date' orders the tags by the
+	// tagger date of annotated tags, and by the commit date of the others.
+	// +kubebuilder:validation:Enum=alphabetical;numerical;date
+	// +required
+	Order string `json:"order"`
+
+	// The regular expression the tags must match to be selected. The
+	// alphabetical and numerical orders use the value of the first capture
+	// group, or the whole match, e.g. ^build-(\d+)$ for build-123 tags.
+	// +optional
+	Include string `json:"include,omitempty"`
+}
+
+// GitRepositoryVerification defines the OpenPGP and SSH signature
+// verification process.
 type GitRepositoryVerification struct {
-	// Mode describes what git object should be verified, currently ('head').
-	// +kubebuilder:validation:Enum=head
+	// Mode describes what git objects should be verified, the HEAD commit
+	// ('head'), all the commits of the history ('all'), or the annotated
+	// tag the reference points to ('tag').
+	// +kubebuilder:validation:Enum=head;all;tag
 	Mode string `json:"mode"`
 
-	// The secret name containing the public keys of all trusted git authors.
+	// Since is the commit the 'all' mode verifies the history from, the
+	// commits it can reach are trusted without verification. Without it,
+	// the whole history has to be signed.
+	// +kubebuilder:validation:Pattern="^[0-9a-f]{40}$"
+	// +optional
+	Since string `json:"since,omitempty"`
+
+	// MatchEmail binds the signing keys to the 'author' or 'committer'
+	// email of the commits, through the PGP key identities or the SSH
+	// allowed signer principals. Tags are bound to the tagger email.
+	// +kubebuilder:validation:Enum=author;committer
+	// +optional
+	MatchEmail string `json:"matchEmail,omitempty"`
+
+	// The secret name containing the PGP public keys of all trusted git
+	// authors, their SSH public keys in the 'allowed_signers' key and the
+	// revoked SSH public keys in the 'revoked_keys' key.
 	SecretRef corev1.LocalObjectReference `json:"secretRef,omitempty"`
 }
 
@@ -93,8 +251,88 @@ type GitRepositoryStatus struct {
 	// Artifact represents the output of the last successful repository sync.
 	// +optional
 	Artifact *Artifact `json:"artifact,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the artifact was
+	// produced from.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// IncludedArtifacts are the artifacts of the included repositories
+	// the artifact was produced with.
+	// +optional
+	IncludedArtifacts []*Artifact `json:"includedArtifacts,omitempty"`
+
+	// TagsDigest is the sha256 digest of the tag references the latest
+	// tag was selected from by date, the selection is unchanged as long
+	// as the tag references are.
+	// +optional
+	TagsDigest string `json:"tagsDigest,omitempty"`
+
+	// VerificationDigest is the sha256 digest of the verification spec
+	// and of the keys of its secret the artifact was verified with.
+	// +optional
+	VerificationDigest string `json:"verificationDigest,omitempty"`
+
+	// BranchArtifacts are the artifacts of the branches matching the
+	// branch pattern.
+	// +optional
+	BranchArtifacts []GitBranchArtifact `json:"branchArtifacts,omitempty"`
+
+	// Verification is the result of the last signature verification.
+	// +optional
+	Verification *GitVerificationStatus `json:"verification,omitempty"`
+}
+
+// GitVerificationStatus holds the result of the signature verification
+// of a GitRepository.
+type GitVerificationStatus struct {
+	// Object is the hash of the verified commit, or of the verified
+	// annotated tag.
+	// +optional
+	Object string `json:"object,omitempty"`
+
+	// Fingerprint is the fingerprint of the key the object is signed with.
+	// +optional
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// Identity is the signer identity, the PGP key identity or the SSH
+	// allowed signer principal.
+	// +optional
+	Identity string `json:"identity,omitempty"`
+
+	// FailedCommit is the first commit that failed verification.
+	// +optional
+	FailedCommit string `json:"failedCommit,omitempty"`
+}
+
+// GitBranchArtifact holds the artifact of a branch matching the branch
+// pattern of a GitRepository.
+type GitBranchArtifact struct {
+	// The git branch name.
+	Branch string `json:"branch"`
+
+	// Artifact represents the output of the last successful branch sync.
+	Artifact *Artifact `json:"artifact"`
 }
 
+const (
+	// GitVerificationModeHead verifies the HEAD commit.
+	GitVerificationModeHead = "head"
+
+	// GitVerificationModeAll verifies all the commits since the last
+	// artifact.
+	GitVerificationModeAll = "all"
+
+	// GitVerificationModeTag verifies the annotated tag of a tag or
+	// semver reference.
+	GitVerificationModeTag = "tag"
+)
+
+const (
+	// GitRepositoryKind is the string representation of a GitRepository.
+	GitRepositoryKind = "GitRepository"
+)
+
 const (
 	// GitOperationSucceedReason represents the fact that the git clone, pull
 	// and checkout operations succeeded.
@@ -103,6 +341,14 @@ const (
 	// GitOperationFailedReason represents the fact that the git clone, pull or
 	// checkout operations failed.
 	GitOperationFailedReason string = "GitOperationFailed"
+
+	// IncludeFailedReason represents the fact that the artifact of an
+	// included repository could not be copied.
+	IncludeFailedReason string = "IncludeFailed"
+
+	// HostKeyVerificationFailedReason represents the fact that the SSH host
+	// key of the repository server is not in the known hosts.
+	HostKeyVerificationFailedReason string = "HostKeyVerificationFailed"
 )
 
 func GitRepositoryReady(repository GitRepository, artifact Artifact, url, reason, message string) GitRepository {
@@ -116,9 +362,12 @@ func GitRepositoryReady(repository GitRepository, artifact Artifact, url, reason
 		},
 	}
 	repository.Status.URL = url
+	repository.Status.ObservedGeneration = repository.Generation
 
 	if repository.Status.Artifact != nil {
-		if repository.Status.Artifact.Path != artifact.Path {
+		if repository.Status.Artifact.Path != artifact.Path ||
+			repository.Status.Artifact.Checksum != artifact.Checksum ||
+			repository.Status.Artifact.Revision != artifact.Revision {
 			repository.Status.Artifact = &artifact
 		}
 	} else {
@@ -128,6 +377,24 @@ func GitRepositoryReady(repository GitRepository, artifact Artifact, url, reason
 	return repository
 }
 
+// GitRepositoryBranchesReady marks a Git repository tracking a branch
+// pattern as ready, its artifacts are listed per branch.
+func GitRepositoryBranchesReady(repository GitRepository, reason, message string) GitRepository {
+	repository.Status.Conditions = []SourceCondition{
+		{
+			Type:               ReadyCondition,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		},
+	}
+	repository.Status.URL = ""
+	repository.Status.Artifact = nil
+	repository.Status.ObservedGeneration = repository.Generation
+	return repository
+}
+
 func GitRepositoryNotReady(repository GitRepository, reason, message string) GitRepository {
 	repository.Status.Conditions = []SourceCondition{
 		{
@@ -24,24 +24,44 @@ import (
 // HelmChartSpec defines the desired state of a Helm chart.
 type HelmChartSpec struct {
 	// The name of the Helm chart, as made available by the referenced
-	// Helm repository.
+	// Helm repository, or the path of the chart directory relative to
+	// the root of the referenced Git repository.
 	// +required
 	Name string `json:"name"`
 
 	// The chart version semver expression, defaults to latest when
-	// omitted.
+	// omitted. Ignored for charts from a GitRepository.
 	// +optional
 	Version string `json:"version,omitempty"`
 
 	// The name of the HelmRepository the chart is available at.
-	// +required
-	HelmRepositoryRef corev1.LocalObjectReference `json:"helmRepositoryRef"`
+	// Deprecated, use the sourceRef instead.
+	// +optional
+	HelmRepositoryRef corev1.LocalObjectReference `json:"helmRepositoryRef,omitempty"`
+
+	// The reference to the source the chart is available at, takes
+	// precedence over the helmRepositoryRef.
+	// +optional
+	SourceRef *LocalHelmChartSourceReference `json:"sourceRef,omitempty"`
 
 	// The interval at which to check the Helm repository for updates.
 	// +required
 	Interval metav1.Duration `json:"interval"`
 }
 
+// LocalHelmChartSourceReference contains enough information to let you locate
+// the typed referenced object at namespace level.
+type LocalHelmChartSourceReference struct {
+	// Kind of the referent, valid values are ('HelmRepository', 'GitRepository').
+	// +kubebuilder:validation:Enum=HelmRepository;GitRepository
+	// +required
+	Kind string `json:"kind"`
+
+	// Name of the referent.
+	// +required
+	Name string `json:"name"`
+}
+
 // HelmChartStatus defines the observed state of the HelmChart.
 type HelmChartStatus struct {
 	// +optional
@@ -54,6 +74,10 @@ type HelmChartStatus struct {
 	// Artifact represents the output of the last successful chart sync.
 	// +optional
 	Artifact *Artifact `json:"artifact,omitempty"`
+
+	// Source is the 'Kind/Name' reference to the source of the chart.
+	// +optional
+	Source string `json:"source,omitempty"`
 }
 
 const (
@@ -64,6 +88,14 @@ const (
 	// ChartPulLSucceededReason represents the fact that the pull of
 	// the Helm chart succeeded.
 	ChartPullSucceededReason string = "ChartPullSucceeded"
+
+	// ChartPackageFailedReason represents the fact that the packaging of
+	// the Helm chart from a Git repository failed.
+	ChartPackageFailedReason string = "ChartPackageFailed"
+
+	// ChartPackageSucceededReason represents the fact that the packaging
+	// of the Helm chart from a Git repository succeeded.
+	ChartPackageSucceededReason string = "ChartPackageSucceeded"
 )
 
 func HelmChartReady(chart HelmChart, artifact Artifact, url, reason, message string) HelmChart {
@@ -79,7 +111,8 @@ func HelmChartReady(chart HelmChart, artifact Artifact, url, reason, message str
 	chart.Status.URL = url
 
 	if chart.Status.Artifact != nil {
-		if chart.Status.Artifact.Path != artifact.Path {
+		if chart.Status.Artifact.Path != artifact.Path ||
+			chart.Status.Artifact.Checksum != artifact.Checksum {
 			chart.Status.Artifact = &artifact
 		}
 	} else {
@@ -111,6 +144,18 @@ func HelmChartReadyMessage(chart HelmChart) string {
 	return ""
 }
 
+// GetSourceRef returns the reference to the source of the chart,
+// falling back to the HelmRepositoryRef when no SourceRef is set.
+func (in *HelmChart) GetSourceRef() LocalHelmChartSourceReference {
+	if in.Spec.SourceRef != nil {
+		return *in.Spec.SourceRef
+	}
+	return LocalHelmChartSourceReference{
+		Kind: HelmRepositoryKind,
+		Name: in.Spec.HelmRepositoryRef.Name,
+	}
+}
+
 // GetArtifact returns the latest artifact from the source
 // if present in the status sub-resource.
 func (in *HelmChart) GetArtifact() *Artifact {
@@ -126,7 +171,7 @@ func (in *HelmChart) GetInterval() metav1.Duration {
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Name",type=string,JSONPath=`.spec.name`
 // +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.spec.version`
-// +kubebuilder:printcolumn:name="Repository",type=string,JSONPath=`.spec.helmRepositoryRef.name`
+// +kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.status.source`
 // +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description=""
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
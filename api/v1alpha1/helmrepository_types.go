@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -24,21 +26,42 @@ import (
 // HelmRepositorySpec defines the reference to a Helm repository.
 type HelmRepositorySpec struct {
 	// The Helm repository URL, a valid URL contains at least a
-	// protocol and host.
+	// protocol and host. For OCI registries the URL has the format
+	// 'oci://<host>/<path>'.
 	// +required
 	URL string `json:"url"`
 
+	// The type of the Helm repository, 'default' for an HTTP/S
+	// repository serving an index.yaml, or 'oci' for an OCI registry.
+	// Defaults to 'default' when omitted.
+	// +kubebuilder:validation:Enum=default;oci
+	// +optional
+	Type string `json:"type,omitempty"`
+
 	// The name of the secret containing authentication credentials
 	// for the Helm repository.
 	// For HTTP/S basic auth the secret must contain username and password
 	// fields.
 	// For TLS the secret must contain caFile, keyFile and caCert fields.
+	// For OCI registries the secret must be of type
+	// 'kubernetes.io/dockerconfigjson', or contain username and password
+	// fields.
 	// +optional
 	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
 
+	// Connect to the OCI registry over plain HTTP, ignored for
+	// repositories of the default type.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
 	// The interval at which to check the upstream for updates.
 	// +required
 	Interval metav1.Duration `json:"interval"`
+
+	// The timeout for OCI registry operations, default ('60s'), ignored
+	// for repositories of the default type.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
 }
 
 // HelmRepositoryStatus defines the observed state of the HelmRepository.
@@ -55,6 +78,19 @@ type HelmRepositoryStatus struct {
 	Artifact *Artifact `json:"artifact,omitempty"`
 }
 
+const (
+	// HelmRepositoryKind is the string representation of a HelmRepository.
+	HelmRepositoryKind = "HelmRepository"
+
+	// HelmRepositoryTypeDefault is the type of a Helm repository
+	// serving an index.yaml over HTTP/S.
+	HelmRepositoryTypeDefault = "default"
+
+	// HelmRepositoryTypeOCI is the type of a Helm repository backed
+	// by an OCI registry.
+	HelmRepositoryTypeOCI = "oci"
+)
+
 const (
 	// IndexationFailedReason represents the fact that the indexation
 	// of the given Helm repository failed.
@@ -63,6 +99,14 @@ const (
 	// IndexationSucceededReason represents the fact that the indexation
 	// of the given Helm repository succeeded.
 	IndexationSucceededReason string = "IndexationSucceed"
+
+	// RegistryOperationFailedReason represents the fact that an
+	// operation against the OCI registry failed.
+	RegistryOperationFailedReason string = "RegistryOperationFailed"
+
+	// RegistryOperationSucceedReason represents the fact that the
+	// OCI registry is reachable with the given credentials.
+	RegistryOperationSucceedReason string = "RegistryOperationSucceed"
 )
 
 func HelmRepositoryReady(repository HelmRepository, artifact Artifact, url, reason, message string) HelmRepository {
@@ -78,7 +122,8 @@ func HelmRepositoryReady(repository HelmRepository, artifact Artifact, url, reas
 	repository.Status.URL = url
 
 	if repository.Status.Artifact != nil {
-		if repository.Status.Artifact.Path != artifact.Path {
+		if repository.Status.Artifact.Path != artifact.Path ||
+			repository.Status.Artifact.Checksum != artifact.Checksum {
 			repository.Status.Artifact = &artifact
 		}
 	} else {
@@ -88,6 +133,23 @@ func HelmRepositoryReady(repository HelmRepository, artifact Artifact, url, reas
 	return repository
 }
 
+// HelmRepositoryReadyWithoutArtifact marks a Helm repository that
+// does not produce an artifact, like an OCI registry, as ready.
+func HelmRepositoryReadyWithoutArtifact(repository HelmRepository, url, reason, message string) HelmRepository {
+	repository.Status.Conditions = []SourceCondition{
+		{
+			Type:               ReadyCondition,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		},
+	}
+	repository.Status.URL = url
+	repository.Status.Artifact = nil
+	return repository
+}
+
 func HelmRepositoryNotReady(repository HelmRepository, reason, message string) HelmRepository {
 	repository.Status.Conditions = []SourceCondition{
 		{
@@ -116,11 +178,24 @@ func (in *HelmRepository) GetArtifact() *Artifact {
 	return in.Status.Artifact
 }
 
+// IsOCI returns true if the repository is backed by an OCI registry.
+func (in *HelmRepository) IsOCI() bool {
+	return in.Spec.Type == HelmRepositoryTypeOCI
+}
+
 // GetInterval returns the interval at which the source is updated.
 func (in *HelmRepository) GetInterval() metav1.Duration {
 	return in.Spec.Interval
 }
 
+// GetTimeout returns the configured timeout or the default.
+func (in *HelmRepository) GetTimeout() metav1.Duration {
+	if in.Spec.Timeout != nil {
+		return *in.Spec.Timeout
+	}
+	return metav1.Duration{Duration: 60 * time.Second}
+}
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.spec.url`
@@ -0,0 +1,183 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HTTPArchiveSpec defines the desired state of an HTTP archive.
+type HTTPArchiveSpec struct {
+	// The URL of the tar.gz or zip archive.
+	// +kubebuilder:validation:Pattern="^(http|https)://"
+	// +required
+	URL string `json:"url"`
+
+	// The checksum to verify the archive against, the archive is not
+	// verified when omitted.
+	// +optional
+	Checksum *HTTPArchiveChecksum `json:"checksum,omitempty"`
+
+	// The name of the secret containing authentication credentials
+	// for the archive URL, and for the checksums file URL when it is on
+	// the same host.
+	// For HTTP/S basic auth the secret must contain username and password
+	// fields.
+	// For TLS the secret must contain certFile, keyFile and caFile fields.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// The interval at which to check for archive updates.
+	// +required
+	Interval metav1.Duration `json:"interval"`
+
+	// Ignore excludes the files matching the patterns from the artifact,
+	// in the .gitignore format. The patterns of the .sourceignore file
+	// found in the archive root are applied in addition to these.
+	// +optional
+	Ignore *string `json:"ignore,omitempty"`
+}
+
+// HTTPArchiveChecksum defines the SHA256 checksum of the archive.
+type HTTPArchiveChecksum struct {
+	// The hex encoded SHA256 checksum of the archive.
+	// +optional
+	SHA256 string `json:"sha256,omitempty"`
+
+	// The URL of a checksums file in the sha256sum format, containing
+	// the checksum of the archive under the archive file name.
+	// Ignored when the sha256 is specified.
+	// +kubebuilder:validation:Pattern="^(http|https)://"
+	// +optional
+	URL string `json:"url,omitempty"`
+}
+
+// HTTPArchiveStatus defines the observed state of an HTTP archive.
+type HTTPArchiveStatus struct {
+	// +optional
+	Conditions []SourceCondition `json:"conditions,omitempty"`
+
+	// URL is the download link for the artifact output of the last
+	// archive sync.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Artifact represents the output of the last successful archive sync.
+	// +optional
+	Artifact *Artifact `json:"artifact,omitempty"`
+}
+
+const (
+	// HTTPArchiveKind is the string representation of an HTTPArchive.
+	HTTPArchiveKind = "HTTPArchive"
+)
+
+const (
+	// DownloadSucceededReason represents the fact that the archive
+	// download and extraction succeeded.
+	DownloadSucceededReason string = "DownloadSucceeded"
+
+	// DownloadFailedReason represents the fact that the archive
+	// download or extraction failed.
+	DownloadFailedReason string = "DownloadFailed"
+)
+
+func HTTPArchiveReady(archive HTTPArchive, artifact Artifact, url, reason, message string) HTTPArchive {
+	archive.Status.Conditions = []SourceCondition{
+		{
+			Type:               ReadyCondition,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		},
+	}
+	archive.Status.URL = url
+
+	if archive.Status.Artifact != nil {
+		if archive.Status.Artifact.Path != artifact.Path ||
+			archive.Status.Artifact.Checksum != artifact.Checksum {
+			archive.Status.Artifact = &artifact
+		}
+	} else {
+		archive.Status.Artifact = &artifact
+	}
+
+	return archive
+}
+
+func HTTPArchiveNotReady(archive HTTPArchive, reason, message string) HTTPArchive {
+	archive.Status.Conditions = []SourceCondition{
+		{
+			Type:               ReadyCondition,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		},
+	}
+	return archive
+}
+
+func HTTPArchiveReadyMessage(archive HTTPArchive) string {
+	for _, condition := range archive.Status.Conditions {
+		if condition.Type == ReadyCondition {
+			return condition.Message
+		}
+	}
+	return ""
+}
+
+// GetArtifact returns the latest artifact from the source
+// if present in the status sub-resource.
+func (in *HTTPArchive) GetArtifact() *Artifact {
+	return in.Status.Artifact
+}
+
+// GetInterval returns the interval at which the source is updated.
+func (in *HTTPArchive) GetInterval() metav1.Duration {
+	return in.Spec.Interval
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.spec.url`
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description=""
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
+
+// HTTPArchive is the Schema for the httparchives API
+type HTTPArchive struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   HTTPArchiveSpec   `json:"spec,omitempty"`
+	Status HTTPArchiveStatus `json:"status,omitempty"`
+}
+
+// HTTPArchiveList contains a list of HTTPArchive
+// +kubebuilder:object:root=true
+type HTTPArchiveList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []HTTPArchive `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&HTTPArchive{}, &HTTPArchiveList{})
+}
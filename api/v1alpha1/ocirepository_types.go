@@ -0,0 +1,205 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OCIRepositorySpec defines the desired state of an OCI repository.
+type OCIRepositorySpec struct {
+	// The OCI repository URL in the format 'oci://<host>/<name>'.
+	// +kubebuilder:validation:Pattern="^oci://"
+	// +required
+	URL string `json:"url"`
+
+	// The OCI reference to pull and monitor for changes, defaults to
+	// the latest tag.
+	// +optional
+	Reference *OCIRepositoryRef `json:"ref,omitempty"`
+
+	// The layer to republish as artifact, defaults to the first layer.
+	// +optional
+	LayerSelector *OCILayerSelector `json:"layerSelector,omitempty"`
+
+	// The secret name containing the registry credentials, the secret
+	// must be of type 'kubernetes.io/dockerconfigjson'.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// Insecure allows connecting to a non-TLS HTTP registry.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+
+	// The interval at which to check for repository updates.
+	// +required
+	Interval metav1.Duration `json:"interval"`
+
+	// The timeout for registry operations, default ('60s').
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// OCIRepositoryRef defines the image reference to pull.
+type OCIRepositoryRef struct {
+	// The tag to pull, defaults to 'latest'.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// The tag semver expression, takes precedence over tag.
+	// +optional
+	SemVer string `json:"semver,omitempty"`
+
+	// The manifest digest to pull, in the format 'sha256:<hex>', takes
+	// precedence over semver and tag.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+}
+
+// OCILayerSelector specifies which layer of the manifest is republished.
+type OCILayerSelector struct {
+	// The media type of the layer, the first layer matching the media
+	// type is selected.
+	// +optional
+	MediaType string `json:"mediaType,omitempty"`
+}
+
+// OCIRepositoryStatus defines the observed state of an OCI repository.
+type OCIRepositoryStatus struct {
+	// +optional
+	Conditions []SourceCondition `json:"conditions,omitempty"`
+
+	// URL is the download link for the artifact output of the last
+	// repository sync.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Artifact represents the output of the last successful repository sync.
+	// +optional
+	Artifact *Artifact `json:"artifact,omitempty"`
+}
+
+const (
+	// OCIRepositoryKind is the string representation of an OCIRepository.
+	OCIRepositoryKind = "OCIRepository"
+)
+
+const (
+	// OCIOperationSucceedReason represents the fact that the manifest
+	// and layer pull operations succeeded.
+	OCIOperationSucceedReason string = "OCIOperationSucceed"
+
+	// OCIOperationFailedReason represents the fact that the tag listing,
+	// manifest or layer pull operations failed.
+	OCIOperationFailedReason string = "OCIOperationFailed"
+)
+
+func OCIRepositoryReady(repository OCIRepository, artifact Artifact, url, reason, message string) OCIRepository {
+	repository.Status.Conditions = []SourceCondition{
+		{
+			Type:               ReadyCondition,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		},
+	}
+	repository.Status.URL = url
+
+	if repository.Status.Artifact != nil {
+		if repository.Status.Artifact.Path != artifact.Path ||
+			repository.Status.Artifact.Checksum != artifact.Checksum {
+			repository.Status.Artifact = &artifact
+		}
+	} else {
+		repository.Status.Artifact = &artifact
+	}
+
+	return repository
+}
+
+func OCIRepositoryNotReady(repository OCIRepository, reason, message string) OCIRepository {
+	repository.Status.Conditions = []SourceCondition{
+		{
+			Type:               ReadyCondition,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		},
+	}
+	return repository
+}
+
+func OCIRepositoryReadyMessage(repository OCIRepository) string {
+	for _, condition := range repository.Status.Conditions {
+		if condition.Type == ReadyCondition {
+			return condition.Message
+		}
+	}
+	return ""
+}
+
+// GetArtifact returns the latest artifact from the source
+// if present in the status sub-resource.
+func (in *OCIRepository) GetArtifact() *Artifact {
+	return in.Status.Artifact
+}
+
+// GetInterval returns the interval at which the source is updated.
+func (in *OCIRepository) GetInterval() metav1.Duration {
+	return in.Spec.Interval
+}
+
+// GetTimeout returns the configured timeout or the default.
+func (in *OCIRepository) GetTimeout() metav1.Duration {
+	if in.Spec.Timeout != nil {
+		return *in.Spec.Timeout
+	}
+	return metav1.Duration{Duration: 60 * time.Second}
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.spec.url`
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description=""
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description=""
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description=""
+
+// OCIRepository is the Schema for the ocirepositories API
+type OCIRepository struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   OCIRepositorySpec   `json:"spec,omitempty"`
+	Status OCIRepositoryStatus `json:"status,omitempty"`
+}
+
+// OCIRepositoryList contains a list of OCIRepository
+// +kubebuilder:object:root=true
+type OCIRepositoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OCIRepository `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OCIRepository{}, &OCIRepositoryList{})
+}
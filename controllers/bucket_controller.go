@@ -0,0 +1,299 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
+	"github.com/fluxcd/source-controller/internal/s3"
+	"github.com/fluxcd/source-controller/internal/sourceignore"
+)
+
+// BucketReconciler reconciles a Bucket object
+type BucketReconciler struct {
+	client.Client
+	Log     logr.Logger
+	Scheme  *runtime.Scheme
+	Storage *Storage
+}
+
+// +kubebuilder:rbac:groups=source.fluxcd.io,resources=buckets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=source.fluxcd.io,resources=buckets/status,verbs=get;update;patch
+
+func (r *BucketReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var bucket sourcev1.Bucket
+	if err := r.Get(ctx, req.NamespacedName, &bucket); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	log := r.Log.WithValues(bucket.Kind, req.NamespacedName)
+
+	// set initial status
+	if reset, status := r.shouldResetStatus(bucket); reset {
+		log.Info("Initializing bucket")
+		bucket.Status = status
+		if err := r.Status().Update(ctx, &bucket); err != nil {
+			log.Error(err, "unable to update Bucket status")
+			return ctrl.Result{Requeue: true}, err
+		}
+	}
+
+	// try to remove old artifacts
+	if err := r.gc(bucket); err != nil {
+		log.Error(err, "artifacts GC failed")
+	}
+
+	// try bucket sync
+	syncedBucket, syncErr := r.sync(*bucket.DeepCopy())
+	if syncErr != nil {
+		log.Error(syncErr, "Bucket sync failed")
+	}
+
+	// update status
+	if err := r.Status().Update(ctx, &syncedBucket); err != nil {
+		log.Error(err, "unable to update Bucket status")
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	if syncErr != nil {
+		return ctrl.Result{Requeue: true}, syncErr
+	}
+
+	log.Info("Bucket sync succeeded", "msg", sourcev1.BucketReadyMessage(syncedBucket))
+
+	// requeue bucket
+	return ctrl.Result{RequeueAfter: bucket.GetInterval().Duration}, nil
+}
+
+func (r *BucketReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&sourcev1.Bucket{}).
+		WithEventFilter(SourceChangePredicate{}).
+		WithEventFilter(GarbageCollectPredicate{Scheme: r.Scheme, Log: r.Log, Storage: r.Storage}).
+		Complete(r)
+}
+
+func (r *BucketReconciler) sync(bucket sourcev1.Bucket) (sourcev1.Bucket, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bucket.GetTimeout().Duration)
+	defer cancel()
+
+	c := s3.New(bucket.Spec.Endpoint, !bucket.Spec.Insecure, bucket.Spec.Region)
+
+	// determine credentials
+	if bucket.Spec.SecretRef != nil {
+		name := types.NamespacedName{
+			Namespace: bucket.GetNamespace(),
+			Name:      bucket.Spec.SecretRef.Name,
+		}
+
+		var secret corev1.Secret
+		err := r.Client.Get(ctx, name, &secret)
+		if err != nil {
+			err = fmt.Errorf("auth secret error: %w", err)
+			return sourcev1.BucketNotReady(bucket, sourcev1.AuthenticationFailedReason, err.Error()), err
+		}
+
+		accessKey, secretKey, err := s3.CredentialsFromSecret(secret)
+		if err != nil {
+			err = fmt.Errorf("auth error: %w", err)
+			return sourcev1.BucketNotReady(bucket, sourcev1.AuthenticationFailedReason, err.Error()), err
+		}
+		c.AccessKey, c.SecretKey = accessKey, secretKey
+	}
+
+	// list bucket objects
+	objects, err := c.ListObjects(ctx, bucket.Spec.BucketName, bucket.Spec.Prefix)
+	if err != nil {
+		err = fmt.Errorf("listing objects from bucket '%s' failed: %w", bucket.Spec.BucketName, err)
+		return sourcev1.BucketNotReady(bucket, sourcev1.BucketOperationFailedReason, err.Error()), err
+	}
+
+	// compute the revision from the listing
+	index := make(map[string]string)
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		index[object.Key] = object.ETag
+	}
+	revision := r.checksumIndex(index)
+
+	// skip the download if the listing matches the current artifact
+	if artifact := bucket.Status.Artifact; artifact != nil &&
+		bucket.Status.ObservedGeneration == bucket.Generation &&
+		artifact.Revision == revision &&
+		r.Storage.ArtifactExist(*artifact) {
+		message := fmt.Sprintf("Bucket revision '%s' is unchanged, artifacts are available at: %s", artifact.Revision, artifact.Path)
+		return sourcev1.BucketReady(bucket, *artifact, bucket.Status.URL, sourcev1.BucketOperationSucceedReason, message), nil
+	}
+
+	// create tmp dir for the downloaded objects
+	tmpDir, err := ioutil.TempDir("", bucket.Name)
+	if err != nil {
+		err = fmt.Errorf("tmp dir error: %w", err)
+		return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// download objects to tmp
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+
+		localPath := filepath.Join(tmpDir, filepath.FromSlash(object.Key))
+		if !strings.HasPrefix(localPath, tmpDir+string(filepath.Separator)) {
+			err = fmt.Errorf("object key '%s' is outside the bucket root", object.Key)
+			return sourcev1.BucketNotReady(bucket, sourcev1.BucketOperationFailedReason, err.Error()), err
+		}
+
+		if err := r.download(ctx, c, bucket.Spec.BucketName, object.Key, localPath); err != nil {
+			err = fmt.Errorf("downloading object '%s' failed: %w", object.Key, err)
+			return sourcev1.BucketNotReady(bucket, sourcev1.BucketOperationFailedReason, err.Error()), err
+		}
+	}
+
+	artifact := r.Storage.ArtifactFor(bucket.Kind, bucket.ObjectMeta.GetObjectMeta(),
+		fmt.Sprintf("%s.tar.gz", revision), revision)
+
+	// create artifact dir
+	err = r.Storage.MkdirAll(artifact)
+	if err != nil {
+		err = fmt.Errorf("mkdir dir error: %w", err)
+		return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// acquire lock
+	unlock, err := r.Storage.Lock(artifact)
+	if err != nil {
+		err = fmt.Errorf("unable to acquire lock: %w", err)
+		return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer unlock()
+
+	// determine the ignore patterns, the objects are included unless
+	// excluded by the spec or the .sourceignore object
+	var ps []gitignore.Pattern
+	if bucket.Spec.Ignore != nil {
+		ps = sourceignore.ReadPatterns(strings.NewReader(*bucket.Spec.Ignore), nil)
+	}
+	filePatterns, err := sourceignore.ReadIgnoreFile(filepath.Join(tmpDir, sourceignore.IgnoreFile), nil)
+	if err != nil {
+		err = fmt.Errorf("failed to read '%s': %w", sourceignore.IgnoreFile, err)
+		return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	ps = append(ps, filePatterns...)
+
+	// archive artifact
+	err = r.Storage.Archive(&artifact, tmpDir, ps)
+	if err != nil {
+		err = fmt.Errorf("storage archive error: %w", err)
+		return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// update latest symlink
+	url, err := r.Storage.Symlink(artifact, "latest.tar.gz")
+	if err != nil {
+		err = fmt.Errorf("storage symlink error: %w", err)
+		return sourcev1.BucketNotReady(bucket, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	message := fmt.Sprintf("Bucket artifacts are available at: %s", artifact.Path)
+	return sourcev1.BucketReady(bucket, artifact, url, sourcev1.BucketOperationSucceedReason, message), nil
+}
+
+func (r *BucketReconciler) download(ctx context.Context, c *s3.Client, bucketName, key, localPath string) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(localPath)
+	if err != nil {
+		return err
+	}
+	if err := c.GetObject(ctx, bucketName, key, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checksumIndex returns a checksum computed from the sorted object
+// keys and their ETags.
+func (r *BucketReconciler) checksumIndex(index map[string]string) string {
+	keys := make([]string, 0, len(index))
+	for key := range index {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, key := range keys {
+		sb.WriteString(fmt.Sprintf("%s %s\n", key, index[key]))
+	}
+	return r.Storage.Checksum([]byte(sb.String()))
+}
+
+func (r *BucketReconciler) shouldResetStatus(bucket sourcev1.Bucket) (bool, sourcev1.BucketStatus) {
+	resetStatus := false
+	if bucket.Status.Artifact != nil {
+		if !r.Storage.ArtifactExist(*bucket.Status.Artifact) {
+			resetStatus = true
+		}
+	}
+
+	if len(bucket.Status.Conditions) == 0 || resetStatus {
+		resetStatus = true
+	}
+
+	return resetStatus, sourcev1.BucketStatus{
+		Conditions: []sourcev1.SourceCondition{
+			{
+				Type:               sourcev1.ReadyCondition,
+				Status:             corev1.ConditionUnknown,
+				Reason:             sourcev1.InitializingReason,
+				LastTransitionTime: metav1.Now(),
+			},
+		},
+	}
+}
+
+func (r *BucketReconciler) gc(bucket sourcev1.Bucket) error {
+	if bucket.Status.Artifact != nil {
+		return r.Storage.RemoveAllButCurrent(*bucket.Status.Artifact)
+	}
+	return nil
+}
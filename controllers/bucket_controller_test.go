@@ -0,0 +1,155 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
+	"github.com/fluxcd/source-controller/internal/s3/s3test"
+)
+
+// reconcileTest reconciles the bucket, and returns it once reconciled.
+func (r *BucketReconciler) reconcileTest(t *testing.T, bucket *sourcev1.Bucket) (sourcev1.Bucket, error) {
+	key := types.NamespacedName{Name: bucket.Name, Namespace: bucket.Namespace}
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+
+	var got sourcev1.Bucket
+	if err := r.Get(context.TODO(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	return got, err
+}
+
+func TestBucketReconciler(t *testing.T) {
+	server := s3test.NewServer("podinfo", "key", 2)
+	defer server.Close()
+	server.PutObject("manifests/deployment.yaml", "kind: Deployment\n")
+	server.PutObject("manifests/service.yaml", "kind: Service\n")
+	server.PutObject("README.md", "# podinfo\n")
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+		Data:       map[string][]byte{"accesskey": []byte("key"), "secretkey": []byte("secret")},
+	}
+	bucket := &sourcev1.Bucket{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default", Generation: 1},
+		Spec: sourcev1.BucketSpec{
+			Endpoint:   server.Endpoint(),
+			BucketName: "podinfo",
+			Insecure:   true,
+			SecretRef:  &corev1.LocalObjectReference{Name: secret.Name},
+			Interval:   metav1.Duration{Duration: time.Minute},
+		},
+	}
+	r := &BucketReconciler{
+		Client:  testClient(t, bucket, secret),
+		Log:     zap.New(zap.UseDevMode(true), zap.WriteTo(ioutil.Discard)),
+		Scheme:  scheme.Scheme,
+		Storage: testStorage(t),
+	}
+	defer os.RemoveAll(r.Storage.BasePath)
+
+	got, err := r.reconcileTest(t, bucket)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	artifact := got.Status.Artifact
+	if artifact == nil || !r.Storage.ArtifactExist(*artifact) {
+		t.Fatalf("Reconcile() artifact = %+v, want an existing artifact", artifact)
+	}
+	entries := archiveEntries(t, artifact.Path)
+	if entries["README.md"] != "# podinfo\n" || entries["manifests/deployment.yaml"] != "kind: Deployment\n" ||
+		entries["manifests/service.yaml"] != "kind: Service\n" {
+		t.Errorf("Reconcile() archive entries = %v, want the bucket objects", entries)
+	}
+	if server.Downloads() != 3 {
+		t.Errorf("Reconcile() downloads = %d, want 3", server.Downloads())
+	}
+
+	// the unchanged listing is not downloaded again
+	got, err = r.reconcileTest(t, bucket)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got.Status.Artifact == nil || *got.Status.Artifact != *artifact {
+		t.Errorf("Reconcile() artifact = %+v, want %+v", got.Status.Artifact, artifact)
+	}
+	if server.Downloads() != 3 {
+		t.Errorf("Reconcile() downloads = %d, want the unchanged listing skipped", server.Downloads())
+	}
+
+	// a changed object is a new revision
+	server.PutObject("manifests/service.yaml", "kind: Service\nmetadata: {}\n")
+	got, err = r.reconcileTest(t, bucket)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got.Status.Artifact == nil || got.Status.Artifact.Revision == artifact.Revision {
+		t.Fatalf("Reconcile() artifact = %+v, want a new revision", got.Status.Artifact)
+	}
+	if server.Downloads() != 6 {
+		t.Errorf("Reconcile() downloads = %d, want 6", server.Downloads())
+	}
+	artifact = got.Status.Artifact
+
+	// a spec change is applied to the unchanged listing
+	ignore := "*.md\n"
+	got.Spec.Ignore = &ignore
+	got.Generation = 2
+	if err := r.Update(context.TODO(), &got); err != nil {
+		t.Fatal(err)
+	}
+	got, err = r.reconcileTest(t, bucket)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got.Status.Artifact == nil || got.Status.Artifact.Revision != artifact.Revision || got.Status.ObservedGeneration != 2 {
+		t.Fatalf("Reconcile() status = %+v, want the revision archived for the generation", got.Status)
+	}
+	if _, ok := archiveEntries(t, got.Status.Artifact.Path)["README.md"]; ok {
+		t.Errorf("Reconcile() archive includes the ignored README.md")
+	}
+	if server.Downloads() != 9 {
+		t.Errorf("Reconcile() downloads = %d, want 9", server.Downloads())
+	}
+
+	// the wrong credentials are rejected
+	secret.Data["accesskey"] = []byte("other")
+	if err := r.Update(context.TODO(), secret); err != nil {
+		t.Fatal(err)
+	}
+	got, err = r.reconcileTest(t, bucket)
+	if err == nil {
+		t.Fatal("Reconcile() expected error for the wrong credentials")
+	}
+	if condition := readyCondition(got.Status.Conditions); condition.Status != corev1.ConditionFalse ||
+		condition.Reason != sourcev1.BucketOperationFailedReason {
+		t.Errorf("Reconcile() condition = %+v, want the listing failed", condition)
+	}
+}
@@ -17,26 +17,39 @@ limitations under the License.
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/blang/semver"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-logr/logr"
+	"golang.org/x/crypto/openpgp"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
 	intgit "github.com/fluxcd/source-controller/internal/git"
+	"github.com/fluxcd/source-controller/internal/sourceignore"
 )
 
 // GitRepositoryReconciler reconciles a GitRepository object
@@ -45,6 +58,14 @@ type GitRepositoryReconciler struct {
 	Log     logr.Logger
 	Scheme  *runtime.Scheme
 	Storage *Storage
+
+	// GitCache is the optional cache of bare clones, when set the
+	// repositories are fetched incrementally instead of cloned.
+	GitCache *intgit.Cache
+
+	// GitCacheGCInterval is the interval at which the least recently
+	// used clones are evicted from the cache.
+	GitCacheGCInterval time.Duration
 }
 
 // +kubebuilder:rbac:groups=source.fluxcd.io,resources=gitrepositories,verbs=get;list;watch;create;update;patch;delete
@@ -77,10 +98,9 @@ func (r *GitRepositoryReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 	}
 
 	// try git sync
-	syncedRepo, err := r.sync(ctx, *repo.DeepCopy())
-	if err != nil {
-		log.Error(err, "Git repository sync failed")
-		return ctrl.Result{Requeue: true}, err
+	syncedRepo, syncErr := r.sync(ctx, *repo.DeepCopy())
+	if syncErr != nil {
+		log.Error(syncErr, "Git repository sync failed")
 	}
 
 	// update status
@@ -89,6 +109,15 @@ func (r *GitRepositoryReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 		return ctrl.Result{Requeue: true}, err
 	}
 
+	// remove the artifacts the saved status no longer references
+	if err := r.gc(syncedRepo); err != nil {
+		log.Error(err, "artifacts GC failed")
+	}
+
+	if syncErr != nil {
+		return ctrl.Result{Requeue: true}, syncErr
+	}
+
 	log.Info("Git repository sync succeeded", "msg", sourcev1.GitRepositoryReadyMessage(syncedRepo))
 
 	// requeue repository
@@ -96,17 +125,192 @@ func (r *GitRepositoryReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 }
 
 func (r *GitRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	c, err := ctrl.NewControllerManagedBy(mgr).
 		For(&sourcev1.GitRepository{}).
 		WithEventFilter(SourceChangePredicate{}).
 		WithEventFilter(GarbageCollectPredicate{Scheme: r.Scheme, Log: r.Log, Storage: r.Storage}).
-		Complete(r)
+		Build(r)
+	if err != nil {
+		return err
+	}
+
+	if r.GitCache != nil {
+		if err := mgr.Add(manager.RunnableFunc(r.gcGitCache)); err != nil {
+			return err
+		}
+	}
+
+	// reconcile the repositories including a repository with a new artifact,
+	// the source change predicate of the builder would filter these updates
+	return c.Watch(&source.Kind{Type: &sourcev1.GitRepository{}},
+		&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.requestsForIncludesOf)},
+		ArtifactChangePredicate{})
+}
+
+// gcGitCache evicts the least recently used clones from the Git cache at
+// every GC interval, rather than after every sync, as it walks the whole
+// cache.
+func (r *GitRepositoryReconciler) gcGitCache(stop <-chan struct{}) error {
+	interval := r.GitCacheGCInterval
+	if interval <= 0 {
+		interval = defaultGitCacheGCInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.GitCache.GC(); err != nil {
+				r.Log.Error(err, "Git cache GC failed")
+			}
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// defaultGitCacheGCInterval is the Git cache GC interval when none is set.
+const defaultGitCacheGCInterval = 5 * time.Minute
+
+// requestsForIncludesOf returns the requests for the repositories
+// including the given repository.
+func (r *GitRepositoryReconciler) requestsForIncludesOf(obj handler.MapObject) []reconcile.Request {
+	var list sourcev1.GitRepositoryList
+	if err := r.List(context.TODO(), &list, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list GitRepositories")
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, repository := range list.Items {
+		for _, incl := range repository.Spec.Include {
+			if incl.GitRepositoryRef.Name == obj.Meta.GetName() {
+				reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+					Namespace: repository.GetNamespace(),
+					Name:      repository.GetName(),
+				}})
+				break
+			}
+		}
+	}
+	return reqs
 }
 
 func (r *GitRepositoryReconciler) sync(ctx context.Context, repository sourcev1.GitRepository) (sourcev1.GitRepository, error) {
+	if _, err := intgit.NewEndpoint(repository.Spec.URL); err != nil {
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.URLInvalidReason, err.Error()), err
+	}
+
+	if repository.Spec.Reference != nil && repository.Spec.Reference.BranchPattern != "" {
+		return r.syncBranches(ctx, repository)
+	}
+	return r.syncRef(ctx, repository, "")
+}
+
+// syncBranches produces an artifact for each remote branch matching the
+// branch pattern, under the branches dir of the repository artifacts. The
+// artifacts of the branches that no longer match are garbage collected
+// once the status is saved.
+func (r *GitRepositoryReconciler) syncBranches(ctx context.Context, repository sourcev1.GitRepository) (sourcev1.GitRepository, error) {
+	pattern := repository.Spec.Reference.BranchPattern
+	if _, err := path.Match(pattern, ""); err != nil {
+		err = fmt.Errorf("invalid branch pattern '%s': %w", pattern, err)
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
+	}
+
+	auth, _, cleanup, err := r.authMethod(ctx, repository)
+	if err != nil {
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	refs, err := intgit.RemoteReferences(repository.Spec.URL, auth)
+	if err != nil {
+		err = fmt.Errorf("git list references error: %w", intgit.AuthError(auth, err))
+		return sourcev1.GitRepositoryNotReady(repository, gitErrorReason(auth, err), err.Error()), err
+	}
+
+	var branches []string
+	for name := range refs {
+		if !name.IsBranch() {
+			continue
+		}
+		if ok, _ := path.Match(pattern, name.Short()); ok {
+			branches = append(branches, name.Short())
+		}
+	}
+	sort.Strings(branches)
+
+	current := make(map[string]*sourcev1.Artifact)
+	for _, ba := range repository.Status.BranchArtifacts {
+		current[ba.Branch] = ba.Artifact
+	}
+
+	var branchArtifacts []sourcev1.GitBranchArtifact
+	var includedArtifacts []*sourcev1.Artifact
+	var verificationDigest string
+	var failed []string
+	for _, branch := range branches {
+		branchRepository := *repository.DeepCopy()
+		branchRepository.Spec.Reference = &sourcev1.GitRepositoryRef{Branch: branch}
+		branchRepository.Status.Artifact = current[branch]
+
+		synced, err := r.syncRef(ctx, branchRepository, branchArtifactDir(branch))
+		if err != nil {
+			r.Log.Error(err, "Git branch sync failed", "branch", branch)
+			failed = append(failed, branch)
+			if current[branch] == nil {
+				continue
+			}
+			// keep serving the last artifact of the branch
+			synced.Status.Artifact = current[branch]
+		} else {
+			includedArtifacts = synced.Status.IncludedArtifacts
+			verificationDigest = synced.Status.VerificationDigest
+		}
+		branchArtifacts = append(branchArtifacts, sourcev1.GitBranchArtifact{
+			Branch:   branch,
+			Artifact: synced.Status.Artifact,
+		})
+	}
+	repository.Status.BranchArtifacts = branchArtifacts
+
+	// the branches are compared to the included artifacts and the keys of
+	// the status to skip the unchanged ones, record them once all branches
+	// have them
+	if len(failed) == 0 {
+		repository.Status.IncludedArtifacts = includedArtifacts
+		repository.Status.VerificationDigest = verificationDigest
+	}
+
+	if len(failed) > 0 {
+		err := fmt.Errorf("git sync failed for branches: %s", strings.Join(failed, ", "))
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
+	}
+
+	message := fmt.Sprintf("Git repository artifacts are available for %d branches matching '%s'", len(branches), pattern)
+	return sourcev1.GitRepositoryBranchesReady(repository, sourcev1.GitOperationSucceedReason, message), nil
+}
+
+// gitBranchesDir is the dir holding the branch artifacts of a repository
+// tracking a branch pattern.
+const gitBranchesDir = "branches"
+
+// branchArtifactDir returns the artifacts dir of the branch, relative to
+// the repository artifacts. The dir is named after the sha256 digest of
+// the branch, to keep the dirs flat and distinct for any branch name.
+func branchArtifactDir(branch string) string {
+	return path.Join(gitBranchesDir, fmt.Sprintf("%x", sha256.Sum256([]byte(branch))))
+}
+
+func (r *GitRepositoryReconciler) syncRef(ctx context.Context, repository sourcev1.GitRepository, artifactDir string) (sourcev1.GitRepository, error) {
 	// set defaults: master branch, no tags fetching, max two commits
 	branch := "master"
-	revision := ""
+	revisionRef := ""
+	tagName := ""
+	tagRefsDigest := ""
 	tagMode := git.NoTags
 	depth := 2
 
@@ -119,40 +323,72 @@ func (r *GitRepositoryReconciler) sync(ctx context.Context, repository sourcev1.
 		}
 		if repository.Spec.Reference.Commit != "" {
 			depth = 0
+		} else if name := repository.Spec.Reference.Name; name != "" {
+			refName = plumbing.ReferenceName(name)
+			revisionRef = name
 		} else {
 			if repository.Spec.Reference.Tag != "" {
-				refName = plumbing.NewTagReferenceName(repository.Spec.Reference.Tag)
+				tagName = repository.Spec.Reference.Tag
+				refName = plumbing.NewTagReferenceName(tagName)
+				revisionRef = tagName
 			}
-			if repository.Spec.Reference.SemVer != "" {
+			if repository.Spec.Reference.SemVer != "" || repository.Spec.Reference.Policy != nil {
 				tagMode = git.AllTags
 			}
 		}
 	}
 
+	if revisionRef == "" {
+		revisionRef = branch
+	}
+
+	// fetch the full history to verify all the commits since the last artifact
+	if repository.Spec.Verification != nil && repository.Spec.Verification.Mode == sourcev1.GitVerificationModeAll {
+		depth = 0
+	}
+
 	// determine auth method
-	var auth transport.AuthMethod
-	if repository.Spec.SecretRef != nil {
-		name := types.NamespacedName{
-			Namespace: repository.GetNamespace(),
-			Name:      repository.Spec.SecretRef.Name,
-		}
+	auth, secret, cleanup, err := r.authMethod(ctx, repository)
+	if err != nil {
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
+	}
+	if cleanup != nil {
+		defer cleanup()
+	}
 
-		var secret corev1.Secret
-		err := r.Client.Get(ctx, name, &secret)
-		if err != nil {
-			err = fmt.Errorf("auth secret error: %w", err)
-			return sourcev1.GitRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
-		}
+	// resolve the artifacts of the included repositories
+	includedArtifacts, err := r.includedArtifacts(ctx, repository)
+	if err != nil {
+		err = fmt.Errorf("include error: %w", err)
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.IncludeFailedReason, err.Error()), err
+	}
 
-		method, cleanup, err := intgit.AuthMethodFromSecret(repository.Spec.URL, secret)
+	// load the trusted keys, the artifact is verified again when they
+	// change
+	var verifier *intgit.Verifier
+	verificationDigest := ""
+	if repository.Spec.Verification != nil {
+		verifier, verificationDigest, err = r.verifier(ctx, repository)
 		if err != nil {
-			err = fmt.Errorf("auth error: %w", err)
-			return sourcev1.GitRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
+			err = fmt.Errorf("public keys secret error: %w", err)
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
 		}
-		if cleanup != nil {
-			defer cleanup()
+	}
+
+	// skip the clone if the remote revision matches the current artifact
+	if artifact := repository.Status.Artifact; artifact != nil &&
+		repository.Status.ObservedGeneration == repository.Generation &&
+		artifactsEqual(repository.Status.IncludedArtifacts, includedArtifacts) &&
+		repository.Status.VerificationDigest == verificationDigest &&
+		r.Storage.ArtifactExist(*artifact) {
+		// listing errors are not fatal, the clone reports them
+		// submodule commits are recorded in the repository, so the
+		// revision suffix with their digest is not compared
+		if rev, err := remoteRevision(repository, auth, refName, revisionRef); err == nil &&
+			(rev == artifact.Revision || repository.Spec.RecurseSubmodules && strings.HasPrefix(artifact.Revision, rev+"+")) {
+			message := fmt.Sprintf("Git repository revision '%s' is unchanged, artifacts are available at: %s", artifact.Revision, artifact.Path)
+			return sourcev1.GitRepositoryReady(repository, *artifact, repository.Status.URL, sourcev1.GitOperationSucceedReason, message), nil
 		}
-		auth = method
 	}
 
 	// create tmp dir for the Git clone
@@ -163,22 +399,22 @@ func (r *GitRepositoryReconciler) sync(ctx context.Context, repository sourcev1.
 	}
 	defer os.RemoveAll(tmpGit)
 
-	// clone to tmp
-	repo, err := git.PlainClone(tmpGit, false, &git.CloneOptions{
-		URL:               repository.Spec.URL,
-		Auth:              auth,
-		RemoteName:        "origin",
-		ReferenceName:     refName,
-		SingleBranch:      true,
-		NoCheckout:        false,
-		Depth:             depth,
-		RecurseSubmodules: 0,
-		Progress:          nil,
-		Tags:              tagMode,
-	})
-	if err != nil {
-		err = fmt.Errorf("git clone error: %w", err)
-		return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
+	// fetch into tmp, or into the cache and check out to tmp
+	var repo *git.Repository
+	if r.GitCache != nil {
+		var unlock func()
+		repo, unlock, err = r.fetchFromCache(repository, auth, refName, tagMode, tmpGit)
+		if err != nil {
+			err = fmt.Errorf("git fetch error: %w", intgit.AuthError(auth, err))
+			return sourcev1.GitRepositoryNotReady(repository, gitErrorReason(auth, err), err.Error()), err
+		}
+		defer unlock()
+	} else {
+		repo, err = intgit.FetchReference(tmpGit, repository.Spec.URL, auth, refName, depth, tagMode)
+		if err != nil {
+			err = fmt.Errorf("git fetch error: %w", intgit.AuthError(auth, err))
+			return sourcev1.GitRepositoryNotReady(repository, gitErrorReason(auth, err), err.Error()), err
+		}
 	}
 
 	// checkout commit or tag
@@ -198,114 +434,134 @@ func (r *GitRepositoryReconciler) sync(ctx context.Context, repository sourcev1.
 				err = fmt.Errorf("git checkout '%s' for '%s' error: %w", commit, branch, err)
 				return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
 			}
-		} else if exp := repository.Spec.Reference.SemVer; exp != "" {
-			rng, err := semver.ParseRange(exp)
-			if err != nil {
-				err = fmt.Errorf("semver parse range error: %w", err)
-				return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
-			}
-
-			repoTags, err := repo.Tags()
+		} else if ref := repository.Spec.Reference; ref.Name == "" && (ref.SemVer != "" || ref.Policy != nil) {
+			tags, dates, err := tagCommits(repo)
 			if err != nil {
 				err = fmt.Errorf("git list tags error: %w", err)
 				return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
 			}
 
-			tags := make(map[string]string)
-			_ = repoTags.ForEach(func(t *plumbing.Reference) error {
-				tags[t.Name().Short()] = t.Strings()[1]
-				return nil
-			})
-
-			svTags := make(map[string]string)
-			var svers []semver.Version
-			for tag, _ := range tags {
-				v, _ := semver.ParseTolerant(tag)
-				if rng(v) {
-					svers = append(svers, v)
-					svTags[v.String()] = tag
-				}
+			names := make([]string, 0, len(tags))
+			for name := range tags {
+				names = append(names, name)
 			}
 
-			if len(svers) > 0 {
-				semver.Sort(svers)
-				v := svers[len(svers)-1]
-				t := svTags[v.String()]
-				commit := tags[t]
-				revision = fmt.Sprintf("%s/%s", t, commit)
+			var t string
+			if ref.SemVer != "" {
+				t, err = intgit.LatestSemverTag(names, ref.SemVer, ref.Prerelease, ref.TagPattern)
+			} else {
+				t, err = intgit.LatestTag(names, ref.Policy.Order, ref.Policy.Include, dates)
+			}
+			if err != nil {
+				return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
+			}
 
-				w, err := repo.Worktree()
+			commit := tags[t]
+			tagName = t
+			revisionRef = t
+			if ref.SemVer == "" && ref.Policy.Order == intgit.TagOrderDate {
+				tagRefsDigest, err = localTagsDigest(repo)
 				if err != nil {
-					err = fmt.Errorf("git worktree error: %w", err)
+					err = fmt.Errorf("git list tags error: %w", err)
 					return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
 				}
+			}
 
-				err = w.Checkout(&git.CheckoutOptions{
-					Hash: plumbing.NewHash(commit),
-				})
-				if err != nil {
-					err = fmt.Errorf("git checkout error: %w", err)
-					return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
-				}
-			} else {
-				err = fmt.Errorf("no match found for semver: %s", repository.Spec.Reference.SemVer)
+			w, err := repo.Worktree()
+			if err != nil {
+				err = fmt.Errorf("git worktree error: %w", err)
+				return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
+			}
+
+			err = w.Checkout(&git.CheckoutOptions{
+				Hash: plumbing.NewHash(commit),
+			})
+			if err != nil {
+				err = fmt.Errorf("git checkout error: %w", err)
 				return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
 			}
 		}
 	}
 
+	// check out submodules
+	var submodules map[string]string
+	if repository.Spec.RecurseSubmodules {
+		authFunc, err := r.submoduleAuthFunc(ctx, repository, secret)
+		if err != nil {
+			err = fmt.Errorf("submodule auth error: %w", err)
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
+		}
+		submodules, err = intgit.UpdateSubmodules(repo, repository.Spec.URL, authFunc, git.DefaultSubmoduleRecursionDepth)
+		if err != nil {
+			err = fmt.Errorf("git submodule error: %w", err)
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
+		}
+	}
+
 	// read commit hash
-	ref, err := repo.Head()
+	commit, err := headCommit(repo)
 	if err != nil {
 		err = fmt.Errorf("git resolve HEAD error: %w", err)
 		return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
 	}
 
-	// verify PGP signature
+	// verify signatures
+	repository.Status.Verification = nil
 	if repository.Spec.Verification != nil {
-		commit, err := repo.CommitObject(ref.Hash())
-		if err != nil {
-			err = fmt.Errorf("git resolve HEAD error: %w", err)
-			return sourcev1.GitRepositoryNotReady(repository, sourcev1.GitOperationFailedReason, err.Error()), err
-		}
-
-		if commit.PGPSignature == "" {
-			err = fmt.Errorf("PGP signature not found for commit '%s'", ref.Hash())
-			return sourcev1.GitRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
-		}
-
-		name := types.NamespacedName{
-			Namespace: repository.GetNamespace(),
-			Name:      repository.Spec.Verification.SecretRef.Name,
-		}
-
-		var secret corev1.Secret
-		err = r.Client.Get(ctx, name, &secret)
-		if err != nil {
-			err = fmt.Errorf("PGP public keys secret error: %w", err)
-			return sourcev1.GitRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
-		}
-
-		var verified bool
-		for _, bytes := range secret.Data {
-			if _, err := commit.Verify(string(bytes)); err == nil {
-				verified = true
-				break
+		if repository.Spec.Verification.Mode == sourcev1.GitVerificationModeTag {
+			if tagName == "" {
+				err = fmt.Errorf("tag verification requires a tag or semver reference")
+				return sourcev1.GitRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
+			}
+			signer, hash, err := verifier.VerifyTag(repo, tagName)
+			if err != nil {
+				return sourcev1.GitRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
+			}
+			repository.Status.Verification = &sourcev1.GitVerificationStatus{
+				Object:      hash.String(),
+				Fingerprint: signer.Fingerprint,
+				Identity:    signer.Identity,
+			}
+		} else {
+			// the head mode trusts the history of HEAD, which the shallow
+			// clone does not have
+			var commits []*object.Commit
+			if repository.Spec.Verification.Mode == sourcev1.GitVerificationModeAll {
+				commits, err = unverifiedCommits(repo, repository, commit, verificationDigest)
+			} else {
+				var c *object.Commit
+				c, err = repo.CommitObject(commit)
+				commits = []*object.Commit{c}
+			}
+			if err != nil {
+				return sourcev1.GitRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
 			}
-		}
 
-		if !verified {
-			err = fmt.Errorf("PGP signature of '%s' can't be verified", commit.Author)
-			return sourcev1.GitRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
+			// verify the oldest commits first to report the first failure,
+			// the status reports the signer of HEAD
+			var signer *intgit.Signer
+			for i := len(commits) - 1; i >= 0; i-- {
+				signer, err = verifier.VerifyCommit(commits[i])
+				if err != nil {
+					repository.Status.Verification = &sourcev1.GitVerificationStatus{FailedCommit: commits[i].Hash.String()}
+					return sourcev1.GitRepositoryNotReady(repository, sourcev1.VerificationFailedReason, err.Error()), err
+				}
+			}
+			repository.Status.Verification = &sourcev1.GitVerificationStatus{
+				Object:      commit.String(),
+				Fingerprint: signer.Fingerprint,
+				Identity:    signer.Identity,
+			}
 		}
 	}
 
-	if revision == "" {
-		revision = fmt.Sprintf("%s/%s", branch, ref.Hash().String())
+	revision := fmt.Sprintf("%s/%s", revisionRef, commit.String())
+	if len(submodules) > 0 {
+		revision = fmt.Sprintf("%s+%s", revision, submodulesDigest(submodules))
 	}
 
 	artifact := r.Storage.ArtifactFor(repository.Kind, repository.ObjectMeta.GetObjectMeta(),
-		fmt.Sprintf("%s.tar.gz", ref.Hash().String()), revision)
+		path.Join(artifactDir, fmt.Sprintf("%s.tar.gz", commit.String())), revision)
 
 	// create artifact dir
 	err = r.Storage.MkdirAll(artifact)
@@ -322,8 +578,29 @@ func (r *GitRepositoryReconciler) sync(ctx context.Context, repository sourcev1.
 	}
 	defer unlock()
 
+	// determine the ignore patterns, the spec overrides the defaults
+	ps := sourceignore.DefaultPatterns()
+	if repository.Spec.Ignore != nil {
+		ps = sourceignore.ReadPatterns(strings.NewReader(*repository.Spec.Ignore), nil)
+	}
+	filePatterns, err := sourceignore.ReadIgnoreFile(filepath.Join(tmpGit, sourceignore.IgnoreFile), nil)
+	if err != nil {
+		err = fmt.Errorf("failed to read '%s': %w", sourceignore.IgnoreFile, err)
+		return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	ps = append(ps, filePatterns...)
+
+	// copy the included artifacts into the checkout
+	for i, incl := range repository.Spec.Include {
+		err = r.Storage.CopyToPath(*includedArtifacts[i], tmpGit, incl.GetFromPath(), incl.GetToPath())
+		if err != nil {
+			err = fmt.Errorf("include '%s' error: %w", incl.GitRepositoryRef.Name, err)
+			return sourcev1.GitRepositoryNotReady(repository, sourcev1.IncludeFailedReason, err.Error()), err
+		}
+	}
+
 	// archive artifact
-	err = r.Storage.Archive(artifact, tmpGit, "")
+	err = r.Storage.Archive(&artifact, tmpGit, ps)
 	if err != nil {
 		err = fmt.Errorf("storage archive error: %w", err)
 		return sourcev1.GitRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
@@ -337,7 +614,455 @@ func (r *GitRepositoryReconciler) sync(ctx context.Context, repository sourcev1.
 	}
 
 	message := fmt.Sprintf("Git repoistory artifacts are available at: %s", artifact.Path)
-	return sourcev1.GitRepositoryReady(repository, artifact, url, sourcev1.GitOperationSucceedReason, message), nil
+	ready := sourcev1.GitRepositoryReady(repository, artifact, url, sourcev1.GitOperationSucceedReason, message)
+	ready.Status.IncludedArtifacts = includedArtifacts
+	ready.Status.TagsDigest = tagRefsDigest
+	ready.Status.VerificationDigest = verificationDigest
+	return ready, nil
+}
+
+// includedArtifacts returns the artifacts of the repositories included by
+// the repository, in the order of the includes. Including repositories
+// that include the repository, directly or not, is refused.
+func (r *GitRepositoryReconciler) includedArtifacts(ctx context.Context, repository sourcev1.GitRepository) ([]*sourcev1.Artifact, error) {
+	var artifacts []*sourcev1.Artifact
+	for _, incl := range repository.Spec.Include {
+		name := types.NamespacedName{
+			Namespace: repository.GetNamespace(),
+			Name:      incl.GitRepositoryRef.Name,
+		}
+		var included sourcev1.GitRepository
+		if err := r.Client.Get(ctx, name, &included); err != nil {
+			return nil, fmt.Errorf("'%s' not found: %w", name.Name, err)
+		}
+		if included.GetArtifact() == nil {
+			return nil, fmt.Errorf("'%s' has no artifact", name.Name)
+		}
+		artifacts = append(artifacts, included.GetArtifact().DeepCopy())
+	}
+
+	visited := map[string]bool{repository.GetName(): true}
+	if err := r.checkIncludeCycle(ctx, repository, visited); err != nil {
+		return nil, err
+	}
+	return artifacts, nil
+}
+
+func (r *GitRepositoryReconciler) checkIncludeCycle(ctx context.Context, repository sourcev1.GitRepository, visited map[string]bool) error {
+	for _, incl := range repository.Spec.Include {
+		if visited[incl.GitRepositoryRef.Name] {
+			return fmt.Errorf("cycle detected including '%s' from '%s'", incl.GitRepositoryRef.Name, repository.GetName())
+		}
+		var included sourcev1.GitRepository
+		name := types.NamespacedName{Namespace: repository.GetNamespace(), Name: incl.GitRepositoryRef.Name}
+		if err := r.Client.Get(ctx, name, &included); err != nil {
+			return fmt.Errorf("'%s' not found: %w", name.Name, err)
+		}
+		visited[name.Name] = true
+		if err := r.checkIncludeCycle(ctx, included, visited); err != nil {
+			return err
+		}
+		delete(visited, name.Name)
+	}
+	return nil
+}
+
+// artifactsEqual reports whether the artifacts have the same revisions
+// and checksums.
+func artifactsEqual(a, b []*sourcev1.Artifact) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Revision != b[i].Revision || a[i].Checksum != b[i].Checksum {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchFromCache fetches the reference into the cached repository of the
+// URL and checks it out in dir. Cached repositories hold the full history,
+// so the fetches after the first one only transfer the new objects.
+func (r *GitRepositoryReconciler) fetchFromCache(repository sourcev1.GitRepository, auth transport.AuthMethod,
+	refName plumbing.ReferenceName, tagMode git.TagMode, dir string) (*git.Repository, func(), error) {
+	refSpecs := []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", refName, refName))}
+	if tagMode == git.AllTags {
+		refSpecs = append(refSpecs, "+refs/tags/*:refs/tags/*")
+	}
+
+	repo, unlock, err := r.GitCache.Fetch(repository.GetNamespace(), repository.Spec.URL, auth, refSpecs, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(refName))
+	if err != nil {
+		unlock()
+		return nil, nil, fmt.Errorf("resolve '%s': %w", refName, err)
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+
+	if err := w.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+		unlock()
+		return nil, nil, fmt.Errorf("checkout '%s': %w", refName, err)
+	}
+	return repo, unlock, nil
+}
+
+// authMethod returns the auth method for the repository URL, the secret
+// it was read from, and an optional func cleaning up after it.
+func (r *GitRepositoryReconciler) authMethod(ctx context.Context, repository sourcev1.GitRepository) (transport.AuthMethod, *corev1.Secret, func(), error) {
+	if repository.Spec.SecretRef == nil {
+		return nil, nil, nil, nil
+	}
+
+	name := types.NamespacedName{
+		Namespace: repository.GetNamespace(),
+		Name:      repository.Spec.SecretRef.Name,
+	}
+
+	var secret corev1.Secret
+	if err := r.Client.Get(ctx, name, &secret); err != nil {
+		return nil, nil, nil, fmt.Errorf("auth secret error: %w", err)
+	}
+
+	auth, cleanup, err := intgit.AuthMethodFromSecret(repository.Spec.URL, secret)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("auth error: %w", err)
+	}
+	setSSHConfig(auth, repository.Spec.SSH)
+	return auth, &secret, cleanup, nil
+}
+
+// setSSHConfig restricts the algorithms of the SSH auth method to the
+// ones of the SSH config, if any.
+func setSSHConfig(auth transport.AuthMethod, config *sourcev1.GitSSHConfig) {
+	sshAuth, ok := auth.(*intgit.SSHAuth)
+	if !ok || config == nil {
+		return
+	}
+	sshAuth.HostKeyAlgorithms = config.HostKeyAlgorithms
+	sshAuth.KexAlgorithms = config.KexAlgorithms
+	sshAuth.Ciphers = config.Ciphers
+}
+
+// gitErrorReason returns the condition reason of the git operation error,
+// telling host key mismatches and rejected credentials apart from the
+// other failures.
+func gitErrorReason(auth transport.AuthMethod, err error) string {
+	switch {
+	case intgit.IsHostKeyError(auth):
+		return sourcev1.HostKeyVerificationFailedReason
+	case intgit.IsAuthError(auth, err):
+		return sourcev1.AuthenticationFailedReason
+	default:
+		return sourcev1.GitOperationFailedReason
+	}
+}
+
+// submoduleAuthFunc returns the func determining the auth method of the
+// submodules, from the credentials of their host, or from the repository
+// credentials for submodules hosted next to the repository.
+func (r *GitRepositoryReconciler) submoduleAuthFunc(ctx context.Context, repository sourcev1.GitRepository,
+	secret *corev1.Secret) (intgit.SubmoduleAuthFunc, error) {
+	secrets := make(map[string]corev1.Secret)
+	if secret != nil {
+		ep, err := intgit.NewEndpoint(repository.Spec.URL)
+		if err != nil {
+			return nil, err
+		}
+		secrets[ep.Host] = *secret
+	}
+	for _, ref := range repository.Spec.SubmoduleSecretRefs {
+		name := types.NamespacedName{
+			Namespace: repository.GetNamespace(),
+			Name:      ref.SecretRef.Name,
+		}
+		var hostSecret corev1.Secret
+		if err := r.Client.Get(ctx, name, &hostSecret); err != nil {
+			return nil, fmt.Errorf("secret for host '%s' error: %w", ref.Host, err)
+		}
+		secrets[ref.Host] = hostSecret
+	}
+
+	// the submodule URLs are validated like the repository URL
+	return func(url string) (transport.AuthMethod, func(), error) {
+		ep, err := intgit.NewEndpoint(url)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the git protocol has no credentials, even for a host with a secret
+		if secret, ok := secrets[ep.Host]; ok && ep.Protocol != "git" {
+			auth, cleanup, err := intgit.AuthMethodFromSecret(url, secret)
+			if err != nil {
+				return nil, nil, err
+			}
+			setSSHConfig(auth, repository.Spec.SSH)
+			return auth, cleanup, nil
+		}
+		return nil, nil, nil
+	}, nil
+}
+
+const (
+	// allowedSignersKey is the key of the verification secret holding the
+	// SSH allowed signers.
+	allowedSignersKey = "allowed_signers"
+
+	// revokedKeysKey is the key of the verification secret holding the
+	// revoked SSH public keys, all the other keys hold PGP public keys.
+	revokedKeysKey = "revoked_keys"
+)
+
+// verifier returns the signature verifier of the repository, with the
+// trusted keys of the verification secret, and the digest of the
+// verification spec and secret.
+func (r *GitRepositoryReconciler) verifier(ctx context.Context, repository sourcev1.GitRepository) (*intgit.Verifier, string, error) {
+	name := types.NamespacedName{
+		Namespace: repository.GetNamespace(),
+		Name:      repository.Spec.Verification.SecretRef.Name,
+	}
+
+	var secret corev1.Secret
+	if err := r.Client.Get(ctx, name, &secret); err != nil {
+		return nil, "", err
+	}
+
+	verifier := &intgit.Verifier{Email: repository.Spec.Verification.MatchEmail}
+	for key, data := range secret.Data {
+		var err error
+		switch key {
+		case allowedSignersKey:
+			verifier.AllowedSigners, err = intgit.ParseAllowedSigners(data)
+		case revokedKeysKey:
+			verifier.RevokedKeys, err = intgit.ParseRevokedKeys(data)
+		default:
+			var keyRing openpgp.EntityList
+			keyRing, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+			verifier.KeyRing = append(verifier.KeyRing, keyRing...)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("'%s' key error: %w", key, err)
+		}
+	}
+	return verifier, verificationDigest(*repository.Spec.Verification, secret), nil
+}
+
+// verificationDigest returns the sha256 digest of the verification spec
+// and of the keys of its secret.
+func verificationDigest(verification sourcev1.GitRepositoryVerification, secret corev1.Secret) string {
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s %s\n", verification.Mode, verification.Since, verification.MatchEmail)
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s %x\n", key, sha256.Sum256(secret.Data[key]))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// unverifiedCommits returns the commits of the history of head the 'all'
+// verification mode has to verify: the commits that are not reachable
+// from the trusted verify.since commit, nor from the commit of the last
+// artifact produced with the same spec and keys. When the artifact commit
+// is no longer in the history, e.g. after a force push, the history is
+// verified back to the since commit.
+func unverifiedCommits(repo *git.Repository, repository sourcev1.GitRepository, head plumbing.Hash, verificationDigest string) ([]*object.Commit, error) {
+	var since []plumbing.Hash
+	if c := repository.Spec.Verification.Since; c != "" {
+		if _, err := repo.CommitObject(plumbing.NewHash(c)); err != nil {
+			return nil, fmt.Errorf("verify.since commit '%s' is not in the history of '%s': %w", c, head, err)
+		}
+		since = append(since, plumbing.NewHash(c))
+	}
+	if artifact := repository.Status.Artifact; artifact != nil && repository.Status.ObservedGeneration == repository.Generation &&
+		repository.Status.VerificationDigest == verificationDigest {
+		c := artifactCommit(artifact.Revision)
+		if _, err := repo.CommitObject(c); err == nil {
+			since = append(since, c)
+		}
+	}
+
+	commits, err := intgit.CommitsSince(repo, head, since...)
+	if err != nil {
+		return nil, fmt.Errorf("git resolve commits since the last artifact error: %w", err)
+	}
+	return commits, nil
+}
+
+// artifactCommit returns the commit hash of an artifact revision in the
+// '<ref>/<commit>[+<submodules digest>]' format.
+func artifactCommit(revision string) plumbing.Hash {
+	hash := revision[strings.LastIndex(revision, "/")+1:]
+	if i := strings.Index(hash, "+"); i >= 0 {
+		hash = hash[:i]
+	}
+	return plumbing.NewHash(hash)
+}
+
+// submodulesDigest returns the sha256 digest of the submodule paths and
+// their commits.
+func submodulesDigest(submodules map[string]string) string {
+	paths := make([]string, 0, len(submodules))
+	for p := range submodules {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, p := range paths {
+		fmt.Fprintf(h, "%s %s\n", p, submodules[p])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// remoteRevision determines the revision the reference of the repository
+// points to by listing the remote references, without cloning. The
+// revision is built like the one of a clone: the revision reference, or
+// the selected tag, followed by the commit.
+func remoteRevision(repository sourcev1.GitRepository, auth transport.AuthMethod,
+	refName plumbing.ReferenceName, revisionRef string) (string, error) {
+	ref := repository.Spec.Reference
+	if ref != nil && ref.Commit != "" {
+		return fmt.Sprintf("%s/%s", revisionRef, ref.Commit), nil
+	}
+
+	refs, err := intgit.RemoteReferences(repository.Spec.URL, auth)
+	if err != nil {
+		return "", err
+	}
+
+	if ref != nil && ref.Name == "" && (ref.SemVer != "" || ref.Policy != nil) {
+		tags := make(map[string]string)
+		hashes := make(map[string]string)
+		var names []string
+		for name, r := range refs {
+			if name.IsTag() {
+				tags[name.Short()] = r.Commit.String()
+				hashes[name.Short()] = r.Hash.String()
+				names = append(names, name.Short())
+			}
+		}
+
+		var t string
+		switch {
+		case ref.SemVer != "":
+			t, err = intgit.LatestSemverTag(names, ref.SemVer, ref.Prerelease, ref.TagPattern)
+		case ref.Policy.Order == intgit.TagOrderDate:
+			// the dates are only known from the tag and commit objects,
+			// the tag references being unchanged, so is the selection
+			artifact := repository.Status.Artifact
+			if artifact == nil || repository.Status.TagsDigest != tagsDigest(hashes) {
+				return "", fmt.Errorf("tag order '%s' requires a clone", ref.Policy.Order)
+			}
+			return artifact.Revision, nil
+		default:
+			t, err = intgit.LatestTag(names, ref.Policy.Order, ref.Policy.Include, nil)
+		}
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s/%s", t, tags[t]), nil
+	}
+
+	r, ok := refs[refName]
+	if !ok {
+		return "", fmt.Errorf("reference '%s' not found", refName)
+	}
+	return fmt.Sprintf("%s/%s", revisionRef, r.Commit), nil
+}
+
+// headCommit returns the commit HEAD points to, annotated tags are peeled
+// to their commit.
+func headCommit(repo *git.Repository) (plumbing.Hash, error) {
+	ref, err := repo.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	tag, err := repo.TagObject(ref.Hash())
+	if err != nil {
+		return ref.Hash(), nil
+	}
+	commit, err := tag.Commit()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return commit.Hash, nil
+}
+
+// localTagsDigest returns the digest of the tag references of the
+// repository.
+func localTagsDigest(repo *git.Repository) (string, error) {
+	repoTags, err := repo.Tags()
+	if err != nil {
+		return "", err
+	}
+
+	hashes := make(map[string]string)
+	err = repoTags.ForEach(func(t *plumbing.Reference) error {
+		hashes[t.Name().Short()] = t.Hash().String()
+		return nil
+	})
+	return tagsDigest(hashes), err
+}
+
+// tagsDigest returns the sha256 digest of the tag names and the hashes
+// they reference, the tag objects of annotated tags are not peeled.
+func tagsDigest(hashes map[string]string) string {
+	names := make([]string, 0, len(hashes))
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s %s\n", name, hashes[name])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// tagCommits returns the commits of the repository tags, annotated tags
+// are peeled to their commit, and the tag dates: the tagger date of the
+// annotated tags, and the committer date of the others.
+func tagCommits(repo *git.Repository) (map[string]string, map[string]time.Time, error) {
+	repoTags, err := repo.Tags()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags := make(map[string]string)
+	dates := make(map[string]time.Time)
+	err = repoTags.ForEach(func(t *plumbing.Reference) error {
+		name := t.Name().Short()
+		if tag, err := repo.TagObject(t.Hash()); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				// not a commit tag
+				return nil
+			}
+			tags[name] = commit.Hash.String()
+			dates[name] = tag.Tagger.When
+			return nil
+		}
+
+		tags[name] = t.Hash().String()
+		if commit, err := repo.CommitObject(t.Hash()); err == nil {
+			dates[name] = commit.Committer.When
+		}
+		return nil
+	})
+	return tags, dates, err
 }
 
 func (r *GitRepositoryReconciler) shouldResetStatus(repository sourcev1.GitRepository) (bool, sourcev1.GitRepositoryStatus) {
@@ -347,6 +1072,11 @@ func (r *GitRepositoryReconciler) shouldResetStatus(repository sourcev1.GitRepos
 			resetStatus = true
 		}
 	}
+	for _, ba := range repository.Status.BranchArtifacts {
+		if ba.Artifact == nil || !r.Storage.ArtifactExist(*ba.Artifact) {
+			resetStatus = true
+		}
+	}
 
 	if len(repository.Status.Conditions) == 0 || resetStatus {
 		resetStatus = true
@@ -364,9 +1094,33 @@ func (r *GitRepositoryReconciler) shouldResetStatus(repository sourcev1.GitRepos
 	}
 }
 
+// gc removes the artifacts the status of the repository does not
+// reference, it must only be called with a saved status.
 func (r *GitRepositoryReconciler) gc(repository sourcev1.GitRepository) error {
 	if repository.Status.Artifact != nil {
 		return r.Storage.RemoveAllButCurrent(*repository.Status.Artifact)
 	}
+	if repository.Spec.Reference == nil || repository.Spec.Reference.BranchPattern == "" {
+		return nil
+	}
+
+	var errors []string
+	keep := make(map[string]bool)
+	for _, ba := range repository.Status.BranchArtifacts {
+		keep[path.Base(branchArtifactDir(ba.Branch))] = true
+		if err := r.Storage.RemoveAllButCurrent(*ba.Artifact); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	// remove the artifacts of the branches that no longer match
+	artifacts := r.Storage.ArtifactFor(repository.Kind, repository.ObjectMeta.GetObjectMeta(), path.Join(gitBranchesDir, "*"), "")
+	if err := r.Storage.RemoveAllButNames(artifacts, keep); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("branch artifacts GC failed: %s", strings.Join(errors, ", "))
+	}
 	return nil
 }
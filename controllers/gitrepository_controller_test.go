@@ -0,0 +1,928 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
+	intgit "github.com/fluxcd/source-controller/internal/git"
+)
+
+// testGitServer serves the repositories of its root dir with the smart
+// HTTP protocol of git http-backend, counting the fetches. The caller
+// closes it.
+type testGitServer struct {
+	*httptest.Server
+	root string
+
+	mu      sync.Mutex
+	fetches int
+}
+
+func newTestGitServer(t *testing.T) *testGitServer {
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git not found")
+	}
+	root, err := ioutil.TempDir("", "git-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &testGitServer{root: root}
+	backend := &cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/git-upload-pack") {
+			s.mu.Lock()
+			s.fetches++
+			s.mu.Unlock()
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// Close shuts the server down and removes its root dir.
+func (s *testGitServer) Close() {
+	s.Server.Close()
+	os.RemoveAll(s.root)
+}
+
+// Fetches returns the number of fetches served.
+func (s *testGitServer) Fetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+// git runs the git command in the dir of the repository.
+func (s *testGitServer) git(t *testing.T, repository string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = filepath.Join(s.root, repository)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+s.root)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// init creates the repository with a first commit on master, and
+// returns its URL.
+func (s *testGitServer) init(t *testing.T, repository string) string {
+	if err := os.MkdirAll(filepath.Join(s.root, repository), 0755); err != nil {
+		t.Fatal(err)
+	}
+	s.git(t, repository, "init", "-q")
+	s.git(t, repository, "symbolic-ref", "HEAD", "refs/heads/master")
+	s.commit(t, repository, "README.md", "# "+repository)
+	return s.URL + "/" + repository + "/.git"
+}
+
+// commit commits the file, and returns the commit hash.
+func (s *testGitServer) commit(t *testing.T, repository, file, content string) string {
+	path := filepath.Join(s.root, repository, file)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.git(t, repository, "add", "-A")
+	s.git(t, repository, "commit", "-q", "-m", "update "+file)
+	return s.git(t, repository, "rev-parse", "HEAD")
+}
+
+// signedCommit commits the file signed with the entity, and returns the
+// commit hash.
+func (s *testGitServer) signedCommit(t *testing.T, repository, file, content string, entity *openpgp.Entity) string {
+	path := filepath.Join(s.root, repository, file)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := git.PlainOpen(filepath.Join(s.root, repository))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add(file); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := w.Commit("update "+file, &git.CommitOptions{
+		Author:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		SignKey: entity,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash.String()
+}
+
+// testPublicKeySecret returns a secret holding the armored public key of
+// the entity.
+func testPublicKeySecret(t *testing.T, name string, entity *openpgp.Entity) *corev1.Secret {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Data:       map[string][]byte{"key.asc": buf.Bytes()},
+	}
+}
+
+// testGitRepositoryReconciler returns a reconciler of the objects, the
+// caller removes its storage base path.
+func testGitRepositoryReconciler(t *testing.T, objs ...runtime.Object) *GitRepositoryReconciler {
+	return &GitRepositoryReconciler{
+		Client:  testClient(t, objs...),
+		Log:     zap.New(zap.UseDevMode(true), zap.WriteTo(ioutil.Discard)),
+		Scheme:  scheme.Scheme,
+		Storage: testStorage(t),
+	}
+}
+
+// testGitRepository returns the repository of the URL and reference.
+func testGitRepository(name, url string, ref *sourcev1.GitRepositoryRef) *sourcev1.GitRepository {
+	return &sourcev1.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: sourcev1.GitRepositorySpec{
+			URL:       url,
+			Reference: ref,
+			Interval:  metav1.Duration{Duration: time.Minute},
+		},
+	}
+}
+
+// reconcileTest reconciles the repository, and returns it once reconciled.
+func (r *GitRepositoryReconciler) reconcileTest(t *testing.T, repository *sourcev1.GitRepository) (sourcev1.GitRepository, error) {
+	key := types.NamespacedName{Name: repository.Name, Namespace: repository.Namespace}
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+
+	var got sourcev1.GitRepository
+	if err := r.Get(context.TODO(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	return got, err
+}
+
+func TestGitRepositoryReconciler_skipUnchangedRevision(t *testing.T) {
+	server := newTestGitServer(t)
+	defer server.Close()
+	url := server.init(t, "repo")
+	server.git(t, "repo", "tag", "v1.0.0")
+	server.git(t, "repo", "tag", "-a", "-m", "v1.1.0", "v1.1.0")
+	server.git(t, "repo", "checkout", "-q", "-b", "dev")
+	server.commit(t, "repo", "dev.txt", "dev")
+	server.git(t, "repo", "checkout", "-q", "master")
+
+	tests := []struct {
+		name         string
+		ref          *sourcev1.GitRepositoryRef
+		wantRevision string
+	}{
+		{"default branch", nil, "master/"},
+		{"branch", &sourcev1.GitRepositoryRef{Branch: "dev"}, "dev/"},
+		{"tag", &sourcev1.GitRepositoryRef{Tag: "v1.0.0"}, "v1.0.0/"},
+		{"annotated tag", &sourcev1.GitRepositoryRef{Tag: "v1.1.0"}, "v1.1.0/"},
+		{"semver", &sourcev1.GitRepositoryRef{SemVer: "1.0.x"}, "v1.0.0/"},
+		{"alphabetical policy", &sourcev1.GitRepositoryRef{Policy: &sourcev1.GitTagPolicy{Order: "alphabetical"}}, "v1.1.0/"},
+		{"date policy", &sourcev1.GitRepositoryRef{Policy: &sourcev1.GitTagPolicy{Order: "date"}}, "v1.1.0/"},
+		{"name", &sourcev1.GitRepositoryRef{Name: "refs/heads/dev"}, "refs/heads/dev/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := testGitRepository("skip", url, tt.ref)
+			r := testGitRepositoryReconciler(t, repository)
+			defer os.RemoveAll(r.Storage.BasePath)
+
+			got, err := r.reconcileTest(t, repository)
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			artifact := got.Status.Artifact
+			if artifact == nil || !strings.HasPrefix(artifact.Revision, tt.wantRevision) {
+				t.Fatalf("Reconcile() artifact = %+v, want revision %s<commit>", artifact, tt.wantRevision)
+			}
+
+			fetches := server.Fetches()
+			got, err = r.reconcileTest(t, repository)
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if got := server.Fetches() - fetches; got != 0 {
+				t.Errorf("Reconcile() fetched %d times, want the unchanged revision skipped", got)
+			}
+			if got.Status.Artifact == nil || got.Status.Artifact.Revision != artifact.Revision {
+				t.Errorf("Reconcile() artifact = %+v, want revision %s", got.Status.Artifact, artifact.Revision)
+			}
+		})
+	}
+}
+
+func TestGitRepositoryReconciler_changeRefSameCommit(t *testing.T) {
+	server := newTestGitServer(t)
+	defer server.Close()
+	url := server.init(t, "repo")
+	commit := server.git(t, "repo", "rev-parse", "HEAD")
+	server.git(t, "repo", "branch", "dev")
+
+	repository := testGitRepository("changed", url, &sourcev1.GitRepositoryRef{Branch: "master"})
+	r := testGitRepositoryReconciler(t, repository)
+	defer os.RemoveAll(r.Storage.BasePath)
+	got, err := r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	// the archive of the same commit has the same path and checksum
+	got.Spec.Reference = &sourcev1.GitRepositoryRef{Name: "refs/heads/dev"}
+	if err := r.Update(context.TODO(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := "refs/heads/dev/" + commit
+	got, err = r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got.Status.Artifact == nil || got.Status.Artifact.Revision != want {
+		t.Fatalf("Reconcile() artifact = %+v, want revision %s", got.Status.Artifact, want)
+	}
+
+	fetches := server.Fetches()
+	if _, err := r.reconcileTest(t, repository); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got := server.Fetches() - fetches; got != 0 {
+		t.Errorf("Reconcile() fetched %d times, want the unchanged revision skipped", got)
+	}
+}
+
+func TestGitRepositoryReconciler_fetchChangedRevision(t *testing.T) {
+	tests := []struct {
+		name   string
+		ref    *sourcev1.GitRepositoryRef
+		change func(t *testing.T, server *testGitServer) string
+	}{
+		{
+			name: "branch",
+			change: func(t *testing.T, server *testGitServer) string {
+				return "master/" + server.commit(t, "repo", "new.txt", "new")
+			},
+		},
+		{
+			name: "date policy",
+			ref:  &sourcev1.GitRepositoryRef{Policy: &sourcev1.GitTagPolicy{Order: "date"}},
+			change: func(t *testing.T, server *testGitServer) string {
+				commit := server.commit(t, "repo", "new.txt", "new")
+				server.git(t, "repo", "tag", "-a", "-m", "latest", "latest")
+				return "latest/" + commit
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestGitServer(t)
+			defer server.Close()
+			url := server.init(t, "repo")
+			server.git(t, "repo", "tag", "-a", "-m", "v1.0.0", "v1.0.0")
+			repository := testGitRepository("changed", url, tt.ref)
+			r := testGitRepositoryReconciler(t, repository)
+			defer os.RemoveAll(r.Storage.BasePath)
+
+			if _, err := r.reconcileTest(t, repository); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			// the tagger dates have a one second resolution
+			time.Sleep(time.Second)
+			want := tt.change(t, server)
+			got, err := r.reconcileTest(t, repository)
+			if err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			if got.Status.Artifact == nil || got.Status.Artifact.Revision != want {
+				t.Errorf("Reconcile() artifact = %+v, want revision %s", got.Status.Artifact, want)
+			}
+		})
+	}
+}
+
+func TestGitRepositoryReconciler_include(t *testing.T) {
+	server := newTestGitServer(t)
+	defer server.Close()
+	url := server.init(t, "repo")
+	server.commit(t, "repo", "deploy/app.yaml", "kind: Deployment")
+	includedURL := server.init(t, "platform")
+	server.commit(t, "platform", "deploy/platform.yaml", "kind: Namespace")
+
+	// the default path is the name of the included repository, the
+	// existing dirs of the repository are merged
+	repository := testGitRepository("app", url, nil)
+	repository.Spec.Include = []sourcev1.GitRepositoryInclude{
+		{GitRepositoryRef: corev1.LocalObjectReference{Name: "platform"}},
+		{GitRepositoryRef: corev1.LocalObjectReference{Name: "platform"}, FromPath: "deploy", ToPath: "deploy"},
+	}
+	included := testGitRepository("platform", includedURL, nil)
+	r := testGitRepositoryReconciler(t, repository, included)
+	defer os.RemoveAll(r.Storage.BasePath)
+	if _, err := r.reconcileTest(t, included); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	got, err := r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	entries := archiveEntries(t, got.Status.Artifact.Path)
+	for path, want := range map[string]string{
+		"README.md":                     "# repo",
+		"deploy/app.yaml":               "kind: Deployment",
+		"deploy/platform.yaml":          "kind: Namespace",
+		"platform/README.md":            "# platform",
+		"platform/deploy/platform.yaml": "kind: Namespace",
+	} {
+		if entries[path] != want {
+			t.Errorf("Reconcile() artifact %s = %q, want %q", path, entries[path], want)
+		}
+	}
+}
+
+func TestGitRepositoryReconciler_skipUnchangedBranches(t *testing.T) {
+	server := newTestGitServer(t)
+	defer server.Close()
+	url := server.init(t, "repo")
+	server.git(t, "repo", "branch", "feature/a")
+	server.git(t, "repo", "branch", "feature/b")
+	includedURL := server.init(t, "included")
+
+	repository := testGitRepository("branches", url, &sourcev1.GitRepositoryRef{BranchPattern: "feature/*"})
+	repository.Spec.Include = []sourcev1.GitRepositoryInclude{
+		{GitRepositoryRef: corev1.LocalObjectReference{Name: "included"}},
+	}
+	included := testGitRepository("included", includedURL, nil)
+	r := testGitRepositoryReconciler(t, repository, included)
+	defer os.RemoveAll(r.Storage.BasePath)
+	if _, err := r.reconcileTest(t, included); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	got, err := r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(got.Status.BranchArtifacts) != 2 || len(got.Status.IncludedArtifacts) != 1 {
+		t.Fatalf("Reconcile() status = %+v, want the artifacts of two branches and one include", got.Status)
+	}
+
+	fetches := server.Fetches()
+	if _, err := r.reconcileTest(t, repository); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got := server.Fetches() - fetches; got != 0 {
+		t.Errorf("Reconcile() fetched %d times, want the unchanged branches skipped", got)
+	}
+}
+
+func TestGitRepositoryReconciler_gitCache(t *testing.T) {
+	server := newTestGitServer(t)
+	defer server.Close()
+	url := server.init(t, "repo")
+
+	// the repositories of two namespaces with the same URL
+	repository := testGitRepository("cached", url, nil)
+	other := testGitRepository("cached", url, nil)
+	other.Namespace = "other"
+	r := testGitRepositoryReconciler(t, repository, other)
+	defer os.RemoveAll(r.Storage.BasePath)
+	cache, err := intgit.NewCache(filepath.Join(r.Storage.BasePath, ".gitcache"), 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.GitCache = cache
+
+	for _, obj := range []*sourcev1.GitRepository{repository, other} {
+		if _, err := r.reconcileTest(t, obj); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+	}
+	entries, err := ioutil.ReadDir(cache.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var repos int
+	for _, entry := range entries {
+		if entry.IsDir() {
+			repos++
+		}
+	}
+	if repos != 2 {
+		t.Errorf("cache got %d repositories, want one per namespace", repos)
+	}
+
+	// the new commit is fetched into the cached repository
+	want := "master/" + server.commit(t, "repo", "new.txt", "new")
+	got, err := r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got.Status.Artifact == nil || got.Status.Artifact.Revision != want {
+		t.Errorf("Reconcile() artifact = %+v, want revision %s", got.Status.Artifact, want)
+	}
+}
+
+func TestGitRepositoryReconciler_branchArtifactDirs(t *testing.T) {
+	server := newTestGitServer(t)
+	defer server.Close()
+	url := server.init(t, "repo")
+	server.git(t, "repo", "branch", "a/b")
+	server.git(t, "repo", "branch", "a--b")
+
+	repository := testGitRepository("branches", url, &sourcev1.GitRepositoryRef{BranchPattern: `a[/\-]*`})
+	r := testGitRepositoryReconciler(t, repository)
+	defer os.RemoveAll(r.Storage.BasePath)
+	got, err := r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(got.Status.BranchArtifacts) != 2 {
+		t.Fatalf("Reconcile() branch artifacts = %+v, want two", got.Status.BranchArtifacts)
+	}
+	a, b := got.Status.BranchArtifacts[0].Artifact, got.Status.BranchArtifacts[1].Artifact
+	if filepath.Dir(a.Path) == filepath.Dir(b.Path) {
+		t.Errorf("Reconcile() stored the artifacts of both branches in %s", filepath.Dir(a.Path))
+	}
+	for _, artifact := range []*sourcev1.Artifact{a, b} {
+		if !r.Storage.ArtifactExist(*artifact) {
+			t.Errorf("Reconcile() artifact %s does not exist", artifact.Path)
+		}
+	}
+}
+
+func TestGitRepositoryReconciler_branchArtifactsLost(t *testing.T) {
+	server := newTestGitServer(t)
+	defer server.Close()
+	url := server.init(t, "repo")
+	server.git(t, "repo", "branch", "feature/a")
+
+	repository := testGitRepository("branches", url, &sourcev1.GitRepositoryRef{BranchPattern: "feature/*"})
+	r := testGitRepositoryReconciler(t, repository)
+	defer os.RemoveAll(r.Storage.BasePath)
+	if _, err := r.reconcileTest(t, repository); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	// the storage is wiped, like an emptyDir on pod restart
+	entries, err := ioutil.ReadDir(r.Storage.BasePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(r.Storage.BasePath, entry.Name())); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if len(got.Status.BranchArtifacts) != 1 {
+		t.Fatalf("Reconcile() branch artifacts = %+v, want one", got.Status.BranchArtifacts)
+	}
+	if artifact := got.Status.BranchArtifacts[0].Artifact; !r.Storage.ArtifactExist(*artifact) {
+		t.Errorf("Reconcile() artifact %s does not exist", artifact.Path)
+	}
+}
+
+func TestGitRepositoryReconciler_branchFailure(t *testing.T) {
+	server := newTestGitServer(t)
+	defer server.Close()
+	url := server.init(t, "repo")
+	server.git(t, "repo", "branch", "feature/a")
+	server.git(t, "repo", "branch", "feature/b")
+
+	repository := testGitRepository("branches", url, &sourcev1.GitRepositoryRef{BranchPattern: "feature/*"})
+	repository.Spec.RecurseSubmodules = true
+	r := testGitRepositoryReconciler(t, repository)
+	defer os.RemoveAll(r.Storage.BasePath)
+	first, err := r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	// update feature/a, and break feature/b with a missing submodule
+	server.git(t, "repo", "checkout", "-q", "feature/a")
+	server.commit(t, "repo", "a.txt", "a")
+	server.git(t, "repo", "checkout", "-q", "feature/b")
+	commit := server.git(t, "repo", "rev-parse", "HEAD")
+	server.git(t, "repo", "update-index", "--add", "--cacheinfo", "160000,"+commit+",missing")
+	server.commit(t, "repo", ".gitmodules", "[submodule \"missing\"]\n\tpath = missing\n\turl = "+server.URL+"/missing/.git\n")
+	server.git(t, "repo", "checkout", "-q", "master")
+
+	got, err := r.reconcileTest(t, repository)
+	if err == nil {
+		t.Fatal("Reconcile() error = nil, want the feature/b sync failure")
+	}
+	if condition := readyCondition(got.Status.Conditions); condition.Status != corev1.ConditionFalse ||
+		!strings.Contains(condition.Message, "feature/b") {
+		t.Errorf("Reconcile() condition = %+v, want the feature/b failure", condition)
+	}
+
+	// the status records the new artifact of feature/a and the last one
+	// of feature/b, both kept by the GC
+	if len(got.Status.BranchArtifacts) != 2 {
+		t.Fatalf("Reconcile() branch artifacts = %+v, want two", got.Status.BranchArtifacts)
+	}
+	if a := got.Status.BranchArtifacts[0].Artifact; a.Revision == first.Status.BranchArtifacts[0].Artifact.Revision {
+		t.Errorf("Reconcile() feature/a revision = %s, want the new commit", a.Revision)
+	}
+	if b := got.Status.BranchArtifacts[1].Artifact; b.Revision != first.Status.BranchArtifacts[1].Artifact.Revision {
+		t.Errorf("Reconcile() feature/b revision = %s, want the last one", b.Revision)
+	}
+	for _, ba := range got.Status.BranchArtifacts {
+		if !r.Storage.ArtifactExist(*ba.Artifact) {
+			t.Errorf("Reconcile() removed the %s artifact %s", ba.Branch, ba.Artifact.Path)
+		}
+	}
+	if r.Storage.ArtifactExist(*first.Status.BranchArtifacts[0].Artifact) {
+		t.Error("Reconcile() kept the previous feature/a artifact")
+	}
+}
+
+func TestGitRepositoryReconciler_verifyHead(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestGitServer(t)
+	defer server.Close()
+	url := server.init(t, "repo")
+
+	// the shallow clone only has the last commits of the history
+	var head string
+	for i := 0; i < 5; i++ {
+		head = server.signedCommit(t, "repo", "signed.txt", fmt.Sprintf("signed %d", i), entity)
+	}
+
+	repository := testGitRepository("verified", url, nil)
+	repository.Spec.Verification = &sourcev1.GitRepositoryVerification{
+		Mode:      sourcev1.GitVerificationModeHead,
+		SecretRef: corev1.LocalObjectReference{Name: "keys"},
+	}
+	r := testGitRepositoryReconciler(t, repository, testPublicKeySecret(t, "keys", entity))
+	defer os.RemoveAll(r.Storage.BasePath)
+
+	got, err := r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got.Status.Verification == nil || got.Status.Verification.Object != head {
+		t.Errorf("Reconcile() verification = %+v, want object %s", got.Status.Verification, head)
+	}
+
+	unsigned := server.commit(t, "repo", "unsigned.txt", "unsigned")
+	got, err = r.reconcileTest(t, repository)
+	if err == nil {
+		t.Fatal("Reconcile() error = nil, want the unsigned HEAD rejected")
+	}
+	if got.Status.Verification == nil || got.Status.Verification.FailedCommit != unsigned {
+		t.Errorf("Reconcile() verification = %+v, want failed commit %s", got.Status.Verification, unsigned)
+	}
+}
+
+func TestGitRepositoryReconciler_verifyAll(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestGitServer(t)
+	defer server.Close()
+	url := server.init(t, "repo")
+	unsigned := server.git(t, "repo", "rev-parse", "HEAD")
+	server.signedCommit(t, "repo", "signed.txt", "signed", entity)
+
+	repository := testGitRepository("verified", url, nil)
+	repository.Spec.Verification = &sourcev1.GitRepositoryVerification{
+		Mode:      sourcev1.GitVerificationModeAll,
+		SecretRef: corev1.LocalObjectReference{Name: "keys"},
+	}
+	r := testGitRepositoryReconciler(t, repository, testPublicKeySecret(t, "keys", entity))
+	defer os.RemoveAll(r.Storage.BasePath)
+
+	// the first sync verifies the whole history, the status records the failure
+	got, err := r.reconcileTest(t, repository)
+	if err == nil {
+		t.Fatal("Reconcile() error = nil, want the unsigned commit rejected")
+	}
+	if condition := readyCondition(got.Status.Conditions); condition.Status != corev1.ConditionFalse ||
+		condition.Reason != sourcev1.VerificationFailedReason {
+		t.Errorf("Reconcile() condition = %+v, want %s", condition, sourcev1.VerificationFailedReason)
+	}
+	if got.Status.Verification == nil || got.Status.Verification.FailedCommit != unsigned {
+		t.Errorf("Reconcile() verification = %+v, want failed commit %s", got.Status.Verification, unsigned)
+	}
+
+	// the history is trusted up to the since commit
+	got.Spec.Verification.Since = unsigned
+	if err := r.Update(context.TODO(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = r.reconcileTest(t, repository); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	// after a force push, the history is verified back to the since commit
+	server.git(t, "repo", "reset", "-q", "--hard", unsigned)
+	rewritten := server.commit(t, "repo", "rewritten.txt", "rewritten")
+	server.signedCommit(t, "repo", "signed.txt", "signed again", entity)
+	got, err = r.reconcileTest(t, repository)
+	if err == nil {
+		t.Fatal("Reconcile() error = nil, want the rewritten unsigned commit rejected")
+	}
+	if got.Status.Verification == nil || got.Status.Verification.FailedCommit != rewritten {
+		t.Errorf("Reconcile() verification = %+v, want failed commit %s", got.Status.Verification, rewritten)
+	}
+
+	server.git(t, "repo", "reset", "-q", "--hard", unsigned)
+	want := "master/" + server.signedCommit(t, "repo", "signed.txt", "signed once more", entity)
+	got, err = r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got.Status.Artifact == nil || got.Status.Artifact.Revision != want {
+		t.Errorf("Reconcile() artifact = %+v, want revision %s", got.Status.Artifact, want)
+	}
+}
+
+func TestGitRepositoryReconciler_verifyChangedKeys(t *testing.T) {
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestGitServer(t)
+	defer server.Close()
+	url := server.init(t, "repo")
+	server.signedCommit(t, "repo", "signed.txt", "signed", entity)
+
+	repository := testGitRepository("verified", url, nil)
+	repository.Spec.Verification = &sourcev1.GitRepositoryVerification{
+		Mode:      sourcev1.GitVerificationModeHead,
+		SecretRef: corev1.LocalObjectReference{Name: "keys"},
+	}
+	r := testGitRepositoryReconciler(t, repository, testPublicKeySecret(t, "keys", entity))
+	defer os.RemoveAll(r.Storage.BasePath)
+	got, err := r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got.Status.VerificationDigest == "" {
+		t.Error("Reconcile() verification digest is empty")
+	}
+
+	// the key is removed from the secret, the unchanged revision is
+	// verified again
+	if err := r.Update(context.TODO(), testPublicKeySecret(t, "keys", other)); err != nil {
+		t.Fatal(err)
+	}
+	got, err = r.reconcileTest(t, repository)
+	if err == nil {
+		t.Fatal("Reconcile() error = nil, want the commit of the removed key rejected")
+	}
+	if condition := readyCondition(got.Status.Conditions); condition.Status != corev1.ConditionFalse ||
+		condition.Reason != sourcev1.VerificationFailedReason {
+		t.Errorf("Reconcile() condition = %+v, want %s", condition, sourcev1.VerificationFailedReason)
+	}
+}
+
+func TestGitRepositoryReconciler_localURL(t *testing.T) {
+	for _, url := range []string{"/var/run/secrets", "file:///var/run/secrets"} {
+		t.Run(url, func(t *testing.T) {
+			repository := testGitRepository("local", url, nil)
+			r := testGitRepositoryReconciler(t, repository)
+			defer os.RemoveAll(r.Storage.BasePath)
+
+			got, err := r.reconcileTest(t, repository)
+			if err == nil {
+				t.Fatal("Reconcile() error = nil, want the local URL refused")
+			}
+			if condition := readyCondition(got.Status.Conditions); condition.Status != corev1.ConditionFalse ||
+				condition.Reason != sourcev1.URLInvalidReason {
+				t.Errorf("Reconcile() condition = %+v, want %s", condition, sourcev1.URLInvalidReason)
+			}
+			if got.Status.Artifact != nil {
+				t.Errorf("Reconcile() artifact = %+v, want none", got.Status.Artifact)
+			}
+		})
+	}
+}
+
+// testSSHKey returns a new ECDSA SSH signer, and its PEM private key.
+func testSSHKey(t *testing.T) (ssh.Signer, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// newTestSSHServer starts an SSH server refusing all the clients after
+// the handshake, and returns its listener. The caller closes it.
+func newTestSSHServer(t *testing.T, hostKey ssh.Signer) net.Listener {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, fmt.Errorf("unknown key")
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				ssh.NewServerConn(conn, config)
+			}()
+		}
+	}()
+	return l
+}
+
+func TestGitRepositoryReconciler_authFailureReason(t *testing.T) {
+	hostKey, _ := testSSHKey(t)
+	otherHostKey, _ := testSSHKey(t)
+	_, identity := testSSHKey(t)
+	sshServer := newTestSSHServer(t, hostKey)
+	defer sshServer.Close()
+	sshAddr := sshServer.Addr().String()
+	sshURL := "ssh://git@" + sshAddr + "/repo.git"
+
+	server := newTestGitServer(t)
+	defer server.Close()
+	httpURL := server.init(t, "repo")
+	protected := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "user" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer protected.Close()
+	httpURL = protected.URL + strings.TrimPrefix(httpURL, server.URL)
+
+	tests := []struct {
+		name        string
+		url         string
+		secretData  map[string][]byte
+		wantReason  string
+		wantMessage string
+	}{
+		{
+			name: "unknown host key",
+			url:  sshURL,
+			secretData: map[string][]byte{
+				"identity":    identity,
+				"known_hosts": []byte(knownhosts.Line([]string{knownhosts.Normalize(sshAddr)}, otherHostKey.PublicKey())),
+			},
+			wantReason: sourcev1.HostKeyVerificationFailedReason,
+		},
+		{
+			name: "unknown SSH key",
+			url:  sshURL,
+			secretData: map[string][]byte{
+				"identity":    identity,
+				"known_hosts": []byte(knownhosts.Line([]string{knownhosts.Normalize(sshAddr)}, hostKey.PublicKey())),
+			},
+			wantReason: sourcev1.AuthenticationFailedReason,
+		},
+		{
+			name:       "wrong password",
+			url:        httpURL,
+			secretData: map[string][]byte{"username": []byte("user"), "password": []byte("wrong")},
+			wantReason: sourcev1.AuthenticationFailedReason,
+		},
+		{
+			name:        "rejected bearer token",
+			url:         httpURL,
+			secretData:  map[string][]byte{"bearerToken": []byte("token")},
+			wantReason:  sourcev1.AuthenticationFailedReason,
+			wantMessage: "bearer token rejected, check that it is valid and can read the repository",
+		},
+		{
+			name:        "credentials for git protocol",
+			url:         "git://" + sshAddr + "/repo.git",
+			secretData:  map[string][]byte{"username": []byte("user"), "password": []byte("secret")},
+			wantReason:  sourcev1.AuthenticationFailedReason,
+			wantMessage: "can't be used with the unauthenticated git:// protocol",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := testGitRepository("auth", tt.url, nil)
+			repository.Spec.SecretRef = &corev1.LocalObjectReference{Name: "credentials"}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+				Data:       tt.secretData,
+			}
+			r := testGitRepositoryReconciler(t, repository, secret)
+			defer os.RemoveAll(r.Storage.BasePath)
+
+			got, err := r.reconcileTest(t, repository)
+			if err == nil {
+				t.Fatal("Reconcile() error = nil, want the authentication failure")
+			}
+			condition := readyCondition(got.Status.Conditions)
+			if condition.Status != corev1.ConditionFalse || condition.Reason != tt.wantReason {
+				t.Errorf("Reconcile() condition = %+v, want %s", condition, tt.wantReason)
+			}
+			if !strings.Contains(condition.Message, tt.wantMessage) {
+				t.Errorf("Reconcile() condition message = %q, want %q", condition.Message, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -18,24 +18,38 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha1"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/repo"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"sigs.k8s.io/yaml"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
 	"github.com/fluxcd/source-controller/internal/helm"
+	"github.com/fluxcd/source-controller/internal/oci"
+	"github.com/fluxcd/source-controller/internal/untar"
 )
 
 // HelmChartReconciler reconciles a HelmChart object
@@ -76,27 +90,71 @@ func (r *HelmChartReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		log.Error(err, "artifacts GC failed")
 	}
 
-	// get referenced chart repository
-	repository, err := r.chartRepository(ctx, chart)
-	if err != nil {
+	// record the source of the chart, printed for the charts referring
+	// to it with the sourceRef and the deprecated helmRepositoryRef
+	sourceRef := chart.GetSourceRef()
+	chart.Status.Source = fmt.Sprintf("%s/%s", sourceRef.Kind, sourceRef.Name)
+
+	// get referenced source and try to pull or package the chart
+	var pulledChart sourcev1.HelmChart
+	switch kind := chart.GetSourceRef().Kind; kind {
+	case sourcev1.HelmRepositoryKind:
+		repository, err := r.chartRepository(ctx, chart)
+		if err != nil {
+			chart = sourcev1.HelmChartNotReady(*chart.DeepCopy(), sourcev1.ChartPullFailedReason, err.Error())
+			if err := r.Status().Update(ctx, &chart); err != nil {
+				log.Error(err, "unable to update HelmChart status")
+				return ctrl.Result{Requeue: true}, err
+			}
+			return ctrl.Result{Requeue: true}, err
+		}
+
+		// set ownership reference so chart is garbage collected on
+		// repository removal
+		if err := r.setOwnerRef(ctx, &chart, repository.GetObjectMeta(), repository.GroupVersionKind()); err != nil {
+			log.Error(err, "failed to set owner reference")
+		}
+
+		// try to pull chart
+		if repository.IsOCI() {
+			pulledChart, err = r.syncFromOCIRepository(repository, *chart.DeepCopy())
+		} else {
+			pulledChart, err = r.sync(repository, *chart.DeepCopy())
+		}
+		if err != nil {
+			log.Error(err, "Helm chart sync failed")
+		}
+	case sourcev1.GitRepositoryKind:
+		repository, err := r.gitRepository(ctx, chart)
+		if err != nil {
+			chart = sourcev1.HelmChartNotReady(*chart.DeepCopy(), sourcev1.ChartPackageFailedReason, err.Error())
+			if err := r.Status().Update(ctx, &chart); err != nil {
+				log.Error(err, "unable to update HelmChart status")
+				return ctrl.Result{Requeue: true}, err
+			}
+			return ctrl.Result{Requeue: true}, err
+		}
+
+		// set ownership reference so chart is garbage collected on
+		// repository removal
+		if err := r.setOwnerRef(ctx, &chart, repository.GetObjectMeta(), repository.GroupVersionKind()); err != nil {
+			log.Error(err, "failed to set owner reference")
+		}
+
+		// try to package chart
+		pulledChart, err = r.syncFromGitRepository(repository, *chart.DeepCopy())
+		if err != nil {
+			log.Error(err, "Helm chart sync failed")
+		}
+	default:
+		err := fmt.Errorf("source kind '%s' is not supported", kind)
 		chart = sourcev1.HelmChartNotReady(*chart.DeepCopy(), sourcev1.ChartPullFailedReason, err.Error())
 		if err := r.Status().Update(ctx, &chart); err != nil {
 			log.Error(err, "unable to update HelmChart status")
 			return ctrl.Result{Requeue: true}, err
 		}
-		return ctrl.Result{Requeue: true}, err
-	}
-
-	// set ownership reference so chart is garbage collected on
-	// repository removal
-	if err := r.setOwnerRef(ctx, &chart, repository); err != nil {
-		log.Error(err, "failed to set owner reference")
-	}
-
-	// try to pull chart
-	pulledChart, err := r.sync(repository, *chart.DeepCopy())
-	if err != nil {
-		log.Error(err, "Helm chart sync failed")
+		// do not requeue as there is no chance on recovery
+		return ctrl.Result{}, nil
 	}
 
 	// update status
@@ -112,11 +170,42 @@ func (r *HelmChartReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 }
 
 func (r *HelmChartReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	c, err := ctrl.NewControllerManagedBy(mgr).
 		For(&sourcev1.HelmChart{}).
 		WithEventFilter(SourceChangePredicate{}).
 		WithEventFilter(GarbageCollectPredicate{Scheme: r.Scheme, Log: r.Log, Storage: r.Storage}).
-		Complete(r)
+		Build(r)
+	if err != nil {
+		return err
+	}
+
+	// rebuild the charts packaged from a repository with a new artifact,
+	// the source change predicate of the builder would filter these updates
+	return c.Watch(&source.Kind{Type: &sourcev1.GitRepository{}},
+		&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.requestsForGitRepository)},
+		ArtifactChangePredicate{})
+}
+
+// requestsForGitRepository returns the requests for the charts packaged
+// from the given repository.
+func (r *HelmChartReconciler) requestsForGitRepository(obj handler.MapObject) []reconcile.Request {
+	var list sourcev1.HelmChartList
+	if err := r.List(context.TODO(), &list, client.InNamespace(obj.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list HelmCharts")
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, chart := range list.Items {
+		sourceRef := chart.GetSourceRef()
+		if sourceRef.Kind == sourcev1.GitRepositoryKind && sourceRef.Name == obj.Meta.GetName() {
+			reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+				Namespace: chart.GetNamespace(),
+				Name:      chart.GetName(),
+			}})
+		}
+	}
+	return reqs
 }
 
 func (r *HelmChartReconciler) sync(repository sourcev1.HelmRepository, chart sourcev1.HelmChart) (sourcev1.HelmChart, error) {
@@ -218,7 +307,7 @@ func (r *HelmChartReconciler) sync(repository sourcev1.HelmRepository, chart sou
 	defer unlock()
 
 	// save artifact to storage
-	err = r.Storage.WriteFile(artifact, chartBytes)
+	err = r.Storage.WriteFile(&artifact, chartBytes)
 	if err != nil {
 		err = fmt.Errorf("unable to write chart file: %w", err)
 		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
@@ -235,14 +324,211 @@ func (r *HelmChartReconciler) sync(repository sourcev1.HelmRepository, chart sou
 	return sourcev1.HelmChartReady(chart, artifact, chartUrl, sourcev1.ChartPullSucceededReason, message), nil
 }
 
+func (r *HelmChartReconciler) syncFromOCIRepository(repository sourcev1.HelmRepository, chart sourcev1.HelmChart) (sourcev1.HelmChart, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), repository.GetTimeout().Duration)
+	defer cancel()
+
+	registry, err := oci.ParseRepository(strings.TrimSuffix(repository.Spec.URL, "/") + "/" + chart.Spec.Name)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.URLInvalidReason, err.Error()), err
+	}
+
+	c, err := ociClient(ctx, r.Client, repository, registry.Host)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.AuthenticationFailedReason, err.Error()), err
+	}
+
+	// find the latest tag matching the version
+	tags, err := c.Tags(ctx, registry)
+	if err != nil {
+		err = fmt.Errorf("failed to list tags of '%s': %w", registry, err)
+		return sourcev1.HelmChartNotReady(chart, r.ociReason(err), err.Error()), err
+	}
+	tag, err := oci.LatestTag(tags, chart.Spec.Version)
+	if err != nil {
+		err = fmt.Errorf("chart '%s' error: %w", chart.Spec.Name, err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+	}
+
+	// pull the chart layer
+	manifest, _, err := c.Manifest(ctx, registry, tag)
+	if err != nil {
+		err = fmt.Errorf("failed to get manifest of '%s:%s': %w", registry, tag, err)
+		return sourcev1.HelmChartNotReady(chart, r.ociReason(err), err.Error()), err
+	}
+	layer, err := oci.ChartLayer(manifest)
+	if err != nil {
+		err = fmt.Errorf("'%s:%s' error: %w", registry, tag, err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPullFailedReason, err.Error()), err
+	}
+
+	// pull the chart to a tmp file
+	tmpFile, err := ioutil.TempFile("", chart.Name)
+	if err != nil {
+		err = fmt.Errorf("tmp file error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+	h := sha1.New()
+	if err := c.Blob(ctx, registry, layer.Digest, io.MultiWriter(tmpFile, h)); err != nil {
+		err = fmt.Errorf("failed to pull chart '%s:%s': %w", registry, tag, err)
+		return sourcev1.HelmChartNotReady(chart, r.ociReason(err), err.Error()), err
+	}
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		err = fmt.Errorf("tmp file error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	name, version := chart.Spec.Name[strings.LastIndex(chart.Spec.Name, "/")+1:], strings.Replace(tag, "_", "+", 1)
+	sum := fmt.Sprintf("%x", h.Sum(nil))
+	artifact := r.Storage.ArtifactFor(chart.Kind, chart.GetObjectMeta(),
+		fmt.Sprintf("%s-%s-%s.tgz", name, version, sum), version)
+
+	// create artifact dir
+	err = r.Storage.MkdirAll(artifact)
+	if err != nil {
+		err = fmt.Errorf("unable to create chart directory: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// acquire lock
+	unlock, err := r.Storage.Lock(artifact)
+	if err != nil {
+		err = fmt.Errorf("unable to acquire lock: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer unlock()
+
+	// save artifact to storage
+	err = r.Storage.Copy(&artifact, tmpFile)
+	if err != nil {
+		err = fmt.Errorf("unable to write chart file: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// update index symlink
+	chartUrl, err := r.Storage.Symlink(artifact, fmt.Sprintf("%s-latest.tgz", name))
+	if err != nil {
+		err = fmt.Errorf("storage error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	message := fmt.Sprintf("Helm chart is available at: %s", artifact.Path)
+	return sourcev1.HelmChartReady(chart, artifact, chartUrl, sourcev1.ChartPullSucceededReason, message), nil
+}
+
+// ociReason returns the condition reason for an OCI registry error.
+func (r *HelmChartReconciler) ociReason(err error) string {
+	if errors.Is(err, oci.ErrUnauthorized) {
+		return sourcev1.AuthenticationFailedReason
+	}
+	return sourcev1.ChartPullFailedReason
+}
+
+func (r *HelmChartReconciler) syncFromGitRepository(repository sourcev1.GitRepository, chart sourcev1.HelmChart) (sourcev1.HelmChart, error) {
+	// the archive is named after the Git artifact revision and the chart
+	// path, packaging it again would only change its timestamps
+	sourceSum := r.Storage.Checksum([]byte(repository.Status.Artifact.Revision + "\n" + chart.Spec.Name))
+	if artifact := chart.Status.Artifact; artifact != nil &&
+		strings.HasSuffix(artifact.Path, fmt.Sprintf("-%s.tgz", sourceSum)) &&
+		r.Storage.ArtifactExist(*artifact) {
+		message := fmt.Sprintf("Helm chart is available at: %s", artifact.Path)
+		return sourcev1.HelmChartReady(chart, *artifact, chart.Status.URL, sourcev1.ChartPackageSucceededReason, message), nil
+	}
+
+	// create tmp dir for the Git repository artifact
+	tmpDir, err := ioutil.TempDir("", chart.Name)
+	if err != nil {
+		err = fmt.Errorf("tmp dir error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// extract Git repository artifact
+	f, err := os.Open(repository.Status.Artifact.Path)
+	if err != nil {
+		err = fmt.Errorf("failed to open Git repository artifact: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	sourceDir := filepath.Join(tmpDir, "source")
+	err = untar.Untar(f, sourceDir)
+	f.Close()
+	if err != nil {
+		err = fmt.Errorf("failed to extract Git repository artifact: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// load the chart from the path, which is restricted to the
+	// repository root
+	chartPath := filepath.Join(sourceDir, filepath.Clean("/"+chart.Spec.Name))
+	helmChart, err := loader.LoadDir(chartPath)
+	if err != nil {
+		err = fmt.Errorf("failed to load chart from path '%s' in GitRepository '%s': %w",
+			chart.Spec.Name, repository.Name, err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
+	}
+
+	// package the chart
+	pkgPath, err := chartutil.Save(helmChart, tmpDir)
+	if err != nil {
+		err = fmt.Errorf("failed to package chart '%s': %w", helmChart.Name(), err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
+	}
+	chartBytes, err := ioutil.ReadFile(pkgPath)
+	if err != nil {
+		return sourcev1.HelmChartNotReady(chart, sourcev1.ChartPackageFailedReason, err.Error()), err
+	}
+
+	// the revision records the commit the chart was packaged from, a
+	// chart change without a version bump is a new revision
+	name, version := helmChart.Name(), helmChart.Metadata.Version
+	revision := fmt.Sprintf("%s+%s", version, artifactCommit(repository.Status.Artifact.Revision))
+	artifact := r.Storage.ArtifactFor(chart.Kind, chart.GetObjectMeta(),
+		fmt.Sprintf("%s-%s-%s.tgz", name, version, sourceSum), revision)
+
+	// create artifact dir
+	err = r.Storage.MkdirAll(artifact)
+	if err != nil {
+		err = fmt.Errorf("unable to create chart directory: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// acquire lock
+	unlock, err := r.Storage.Lock(artifact)
+	if err != nil {
+		err = fmt.Errorf("unable to acquire lock: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer unlock()
+
+	// save artifact to storage
+	err = r.Storage.WriteFile(&artifact, chartBytes)
+	if err != nil {
+		err = fmt.Errorf("unable to write chart file: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// update index symlink
+	chartUrl, err := r.Storage.Symlink(artifact, fmt.Sprintf("%s-latest.tgz", name))
+	if err != nil {
+		err = fmt.Errorf("storage error: %w", err)
+		return sourcev1.HelmChartNotReady(chart, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	message := fmt.Sprintf("Helm chart is available at: %s", artifact.Path)
+	return sourcev1.HelmChartReady(chart, artifact, chartUrl, sourcev1.ChartPackageSucceededReason, message), nil
+}
+
 func (r *HelmChartReconciler) chartRepository(ctx context.Context, chart sourcev1.HelmChart) (sourcev1.HelmRepository, error) {
-	if chart.Spec.HelmRepositoryRef.Name == "" {
+	ref := chart.GetSourceRef()
+	if ref.Name == "" {
 		return sourcev1.HelmRepository{}, fmt.Errorf("no HelmRepository reference given")
 	}
 
 	name := types.NamespacedName{
 		Namespace: chart.GetNamespace(),
-		Name:      chart.Spec.HelmRepositoryRef.Name,
+		Name:      ref.Name,
 	}
 
 	var repository sourcev1.HelmRepository
@@ -252,13 +538,38 @@ func (r *HelmChartReconciler) chartRepository(ctx context.Context, chart sourcev
 		return repository, err
 	}
 
-	if repository.Status.Artifact == nil {
+	if repository.Status.Artifact == nil && !repository.IsOCI() {
 		err = fmt.Errorf("no repository index artifect found in HelmRepository '%s'", repository.Name)
 	}
 
 	return repository, err
 }
 
+func (r *HelmChartReconciler) gitRepository(ctx context.Context, chart sourcev1.HelmChart) (sourcev1.GitRepository, error) {
+	ref := chart.GetSourceRef()
+	if ref.Name == "" {
+		return sourcev1.GitRepository{}, fmt.Errorf("no GitRepository reference given")
+	}
+
+	name := types.NamespacedName{
+		Namespace: chart.GetNamespace(),
+		Name:      ref.Name,
+	}
+
+	var repository sourcev1.GitRepository
+	err := r.Client.Get(ctx, name, &repository)
+	if err != nil {
+		err = fmt.Errorf("failed to get GitRepository '%s': %w", name, err)
+		return repository, err
+	}
+
+	if repository.Status.Artifact == nil {
+		err = fmt.Errorf("no artifact found in GitRepository '%s'", repository.Name)
+	}
+
+	return repository, err
+}
+
 func (r *HelmChartReconciler) shouldResetStatus(chart sourcev1.HelmChart) (bool, sourcev1.HelmChartStatus) {
 	resetStatus := false
 	if chart.Status.Artifact != nil {
@@ -291,11 +602,18 @@ func (r *HelmChartReconciler) gc(chart sourcev1.HelmChart) error {
 	return nil
 }
 
-func (r *HelmChartReconciler) setOwnerRef(ctx context.Context, chart *sourcev1.HelmChart, repository sourcev1.HelmRepository) error {
-	if !metav1.IsControlledBy(chart.GetObjectMeta(), repository.GetObjectMeta()) {
-		chart.SetOwnerReferences(append(chart.GetOwnerReferences(),
-			*metav1.NewControllerRef(repository.GetObjectMeta(), repository.GroupVersionKind())))
-		return r.Update(ctx, chart)
+func (r *HelmChartReconciler) setOwnerRef(ctx context.Context, chart *sourcev1.HelmChart, owner metav1.Object, gvk schema.GroupVersionKind) error {
+	if metav1.IsControlledBy(chart.GetObjectMeta(), owner) {
+		return nil
 	}
-	return nil
+
+	// replace the controller reference of the previous source
+	refs := []metav1.OwnerReference{*metav1.NewControllerRef(owner, gvk)}
+	for _, ref := range chart.GetOwnerReferences() {
+		if ref.Controller == nil || !*ref.Controller {
+			refs = append(refs, ref)
+		}
+	}
+	chart.SetOwnerReferences(refs)
+	return r.Update(ctx, chart)
 }
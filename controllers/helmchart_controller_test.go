@@ -0,0 +1,140 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
+)
+
+// testGitArtifact archives the files as the artifact of the repository
+// at the revision.
+func testGitArtifact(t *testing.T, storage *Storage, repository *sourcev1.GitRepository, revision string, files map[string]string) *sourcev1.Artifact {
+	dir, err := ioutil.TempDir("", "source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	createFiles(t, dir, files)
+
+	artifact := storage.ArtifactFor(sourcev1.GitRepositoryKind, repository.GetObjectMeta(),
+		artifactCommit(revision).String()+".tar.gz", revision)
+	if err := storage.MkdirAll(artifact); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Archive(&artifact, dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	return &artifact
+}
+
+func TestHelmChartReconciler_gitRepository(t *testing.T) {
+	chartYAML := "apiVersion: v2\nname: podinfo\nversion: 1.0.0\n"
+	storage := testStorage(t)
+	defer os.RemoveAll(storage.BasePath)
+	repository := &sourcev1.GitRepository{
+		TypeMeta:   metav1.TypeMeta{Kind: sourcev1.GitRepositoryKind, APIVersion: sourcev1.GroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: "repo", Namespace: "default", UID: "repo-uid"},
+	}
+	first := "master/1111111111111111111111111111111111111111"
+	repository.Status.Artifact = testGitArtifact(t, storage, repository, first, map[string]string{
+		"charts/podinfo/Chart.yaml":               chartYAML,
+		"charts/podinfo/templates/configmap.yaml": "kind: ConfigMap\n",
+	})
+
+	// the chart was pulled from a Helm repository before
+	controller := true
+	chart := &sourcev1.HelmChart{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "podinfo",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: sourcev1.GroupVersion.String(),
+				Kind:       sourcev1.HelmRepositoryKind,
+				Name:       "helm",
+				UID:        "helm-uid",
+				Controller: &controller,
+			}},
+		},
+		Spec: sourcev1.HelmChartSpec{
+			Name:      "charts/podinfo",
+			SourceRef: &sourcev1.LocalHelmChartSourceReference{Kind: sourcev1.GitRepositoryKind, Name: "repo"},
+			Interval:  metav1.Duration{Duration: time.Minute},
+		},
+	}
+	r := &HelmChartReconciler{
+		Client:  testClient(t, repository, chart),
+		Log:     zap.New(zap.UseDevMode(true), zap.WriteTo(ioutil.Discard)),
+		Scheme:  scheme.Scheme,
+		Storage: storage,
+	}
+	key := types.NamespacedName{Name: chart.Name, Namespace: chart.Namespace}
+	reconcile := func() sourcev1.HelmChart {
+		if _, err := r.Reconcile(ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		var got sourcev1.HelmChart
+		if err := r.Get(context.TODO(), key, &got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	got := reconcile()
+	artifact := got.Status.Artifact
+	if artifact == nil || artifact.Revision != "1.0.0+1111111111111111111111111111111111111111" {
+		t.Fatalf("Reconcile() artifact = %+v, want the chart version with the commit", artifact)
+	}
+	if !storage.ArtifactExist(*artifact) {
+		t.Errorf("Reconcile() artifact %s does not exist", artifact.Path)
+	}
+	if refs := got.GetOwnerReferences(); len(refs) != 1 || refs[0].Name != repository.Name {
+		t.Errorf("Reconcile() owner references = %+v, want the GitRepository only", refs)
+	}
+
+	// the unchanged Git artifact is not packaged again
+	if got := reconcile().Status.Artifact; got == nil || got.Path != artifact.Path ||
+		got.Checksum != artifact.Checksum || !got.LastUpdateTime.Equal(&artifact.LastUpdateTime) {
+		t.Errorf("Reconcile() artifact = %+v, want %+v", got, artifact)
+	}
+
+	// a chart change without a version bump is a new revision
+	second := "master/2222222222222222222222222222222222222222"
+	repository.Status.Artifact = testGitArtifact(t, storage, repository, second, map[string]string{
+		"charts/podinfo/Chart.yaml":               chartYAML,
+		"charts/podinfo/templates/configmap.yaml": "kind: ConfigMap\nmetadata: {}\n",
+	})
+	if err := r.Status().Update(context.TODO(), repository); err != nil {
+		t.Fatal(err)
+	}
+	got = reconcile()
+	if got.Status.Artifact == nil || got.Status.Artifact.Revision != "1.0.0+2222222222222222222222222222222222222222" ||
+		got.Status.Artifact.Path == artifact.Path {
+		t.Errorf("Reconcile() artifact = %+v, want a new revision", got.Status.Artifact)
+	}
+}
@@ -18,8 +18,10 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"net/url"
 	"path"
 	"time"
@@ -37,6 +39,7 @@ import (
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
 	"github.com/fluxcd/source-controller/internal/helm"
+	"github.com/fluxcd/source-controller/internal/oci"
 )
 
 // HelmRepositoryReconciler reconciles a HelmRepository object
@@ -105,6 +108,10 @@ func (r *HelmRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
 }
 
 func (r *HelmRepositoryReconciler) sync(repository sourcev1.HelmRepository) (sourcev1.HelmRepository, error) {
+	if repository.IsOCI() {
+		return r.syncOCI(repository)
+	}
+
 	u, err := url.Parse(repository.Spec.URL)
 	if err != nil {
 		return sourcev1.HelmRepositoryNotReady(repository, sourcev1.URLInvalidReason, err.Error()), err
@@ -183,7 +190,7 @@ func (r *HelmRepositoryReconciler) sync(repository sourcev1.HelmRepository) (sou
 	defer unlock()
 
 	// save artifact to storage
-	err = r.Storage.WriteFile(artifact, index)
+	err = r.Storage.WriteFile(&artifact, index)
 	if err != nil {
 		err = fmt.Errorf("unable to write repository index file: %w", err)
 		return sourcev1.HelmRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
@@ -200,6 +207,36 @@ func (r *HelmRepositoryReconciler) sync(repository sourcev1.HelmRepository) (sou
 	return sourcev1.HelmRepositoryReady(repository, artifact, indexURL, sourcev1.IndexationSucceededReason, message), nil
 }
 
+func (r *HelmRepositoryReconciler) syncOCI(repository sourcev1.HelmRepository) (sourcev1.HelmRepository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), repository.GetTimeout().Duration)
+	defer cancel()
+
+	registry, err := oci.ParseRepository(repository.Spec.URL)
+	if err != nil {
+		return sourcev1.HelmRepositoryNotReady(repository, sourcev1.URLInvalidReason, err.Error()), err
+	}
+
+	c, err := ociClient(ctx, r.Client, repository, registry.Host)
+	if err != nil {
+		return sourcev1.HelmRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
+	}
+
+	// verify the registry is reachable with the given credentials,
+	// the charts are resolved by the HelmChart reconciler
+	if err := c.Ping(ctx, registry.Host); err != nil {
+		reason := sourcev1.RegistryOperationFailedReason
+		if errors.Is(err, oci.ErrUnauthorized) {
+			reason = sourcev1.AuthenticationFailedReason
+		}
+		err = fmt.Errorf("OCI registry '%s' error: %w", registry.Host, err)
+		return sourcev1.HelmRepositoryNotReady(repository, reason, err.Error()), err
+	}
+
+	message := fmt.Sprintf("OCI registry is available at: %s", registry.Host)
+	return sourcev1.HelmRepositoryReadyWithoutArtifact(repository, registry.String(),
+		sourcev1.RegistryOperationSucceedReason, message), nil
+}
+
 func (r *HelmRepositoryReconciler) shouldResetStatus(repository sourcev1.HelmRepository) (bool, sourcev1.HelmRepositoryStatus) {
 	resetStatus := false
 	if repository.Status.Artifact != nil {
@@ -231,3 +268,32 @@ func (r *HelmRepositoryReconciler) gc(repository sourcev1.HelmRepository) error
 	}
 	return nil
 }
+
+// ociClient returns a registry client for the OCI Helm repository,
+// authenticating with the credentials from the referenced secret, and
+// timing out after the repository timeout.
+func ociClient(ctx context.Context, kubeClient client.Client, repository sourcev1.HelmRepository, host string) (*oci.Client, error) {
+	c := oci.NewClient("", "")
+	c.HTTPClient = &http.Client{Timeout: repository.GetTimeout().Duration}
+	c.PlainHTTP = repository.Spec.Insecure
+	if repository.Spec.SecretRef == nil {
+		return c, nil
+	}
+
+	name := types.NamespacedName{
+		Namespace: repository.GetNamespace(),
+		Name:      repository.Spec.SecretRef.Name,
+	}
+
+	var secret corev1.Secret
+	if err := kubeClient.Get(ctx, name, &secret); err != nil {
+		return nil, fmt.Errorf("auth secret error: %w", err)
+	}
+
+	username, password, err := oci.CredentialsFromSecret(secret, host)
+	if err != nil {
+		return nil, fmt.Errorf("auth error: %w", err)
+	}
+	c.Username, c.Password = username, password
+	return c, nil
+}
@@ -0,0 +1,394 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
+	"github.com/fluxcd/source-controller/internal/checksum"
+	intgit "github.com/fluxcd/source-controller/internal/git"
+	"github.com/fluxcd/source-controller/internal/sourceignore"
+	"github.com/fluxcd/source-controller/internal/untar"
+	"github.com/fluxcd/source-controller/internal/unzip"
+)
+
+// HTTPArchiveReconciler reconciles a HTTPArchive object
+type HTTPArchiveReconciler struct {
+	client.Client
+	Log     logr.Logger
+	Scheme  *runtime.Scheme
+	Storage *Storage
+
+	// MaxArchiveSize is the maximum size of the downloaded archives,
+	// defaults to DefaultMaxArchiveSize.
+	MaxArchiveSize int64
+}
+
+// +kubebuilder:rbac:groups=source.fluxcd.io,resources=httparchives,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=source.fluxcd.io,resources=httparchives/status,verbs=get;update;patch
+
+func (r *HTTPArchiveReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var archive sourcev1.HTTPArchive
+	if err := r.Get(ctx, req.NamespacedName, &archive); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	log := r.Log.WithValues(archive.Kind, req.NamespacedName)
+
+	// set initial status
+	if reset, status := r.shouldResetStatus(archive); reset {
+		log.Info("Initializing HTTP archive")
+		archive.Status = status
+		if err := r.Status().Update(ctx, &archive); err != nil {
+			log.Error(err, "unable to update HTTPArchive status")
+			return ctrl.Result{Requeue: true}, err
+		}
+	}
+
+	// try to remove old artifacts
+	if err := r.gc(archive); err != nil {
+		log.Error(err, "artifacts GC failed")
+	}
+
+	// try to download the archive
+	syncedArchive, syncErr := r.sync(*archive.DeepCopy())
+	if syncErr != nil {
+		log.Error(syncErr, "HTTP archive sync failed")
+	}
+
+	// update status
+	if err := r.Status().Update(ctx, &syncedArchive); err != nil {
+		log.Error(err, "unable to update HTTPArchive status")
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	if syncErr != nil {
+		return ctrl.Result{Requeue: true}, syncErr
+	}
+
+	log.Info("HTTP archive sync succeeded", "msg", sourcev1.HTTPArchiveReadyMessage(syncedArchive))
+
+	// requeue archive
+	return ctrl.Result{RequeueAfter: archive.GetInterval().Duration}, nil
+}
+
+func (r *HTTPArchiveReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&sourcev1.HTTPArchive{}).
+		WithEventFilter(SourceChangePredicate{}).
+		WithEventFilter(GarbageCollectPredicate{Scheme: r.Scheme, Log: r.Log, Storage: r.Storage}).
+		Complete(r)
+}
+
+func (r *HTTPArchiveReconciler) sync(archive sourcev1.HTTPArchive) (sourcev1.HTTPArchive, error) {
+	u, err := url.Parse(archive.Spec.URL)
+	if err != nil {
+		return sourcev1.HTTPArchiveNotReady(archive, sourcev1.URLInvalidReason, err.Error()), err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		err = fmt.Errorf("scheme '%s' is not supported", u.Scheme)
+		return sourcev1.HTTPArchiveNotReady(archive, sourcev1.URLInvalidReason, err.Error()), err
+	}
+
+	// the credentials of the secret are only sent to the archive host
+	var creds, anonymous downloader
+	if archive.Spec.SecretRef != nil {
+		name := types.NamespacedName{
+			Namespace: archive.GetNamespace(),
+			Name:      archive.Spec.SecretRef.Name,
+		}
+
+		var secret corev1.Secret
+		err := r.Client.Get(context.TODO(), name, &secret)
+		if err != nil {
+			err = fmt.Errorf("auth secret error: %w", err)
+			return sourcev1.HTTPArchiveNotReady(archive, sourcev1.AuthenticationFailedReason, err.Error()), err
+		}
+
+		creds, anonymous, err = downloadersFromSecret(secret)
+		if err != nil {
+			err = fmt.Errorf("auth options error: %w", err)
+			return sourcev1.HTTPArchiveNotReady(archive, sourcev1.AuthenticationFailedReason, err.Error()), err
+		}
+	}
+
+	// create tmp dir for the downloaded and extracted archive
+	tmpDir, err := ioutil.TempDir("", archive.Name)
+	if err != nil {
+		err = fmt.Errorf("tmp dir error: %w", err)
+		return sourcev1.HTTPArchiveNotReady(archive, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// download the archive to a file, hashing it on the way
+	maxSize := r.MaxArchiveSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxArchiveSize
+	}
+	f, err := os.Create(filepath.Join(tmpDir, "archive"))
+	if err != nil {
+		err = fmt.Errorf("tmp file error: %w", err)
+		return sourcev1.HTTPArchiveNotReady(archive, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := creds.download(u.String(), io.MultiWriter(f, h), maxSize)
+	if err != nil {
+		return sourcev1.HTTPArchiveNotReady(archive, sourcev1.DownloadFailedReason, err.Error()), err
+	}
+	revision := fmt.Sprintf("%x", h.Sum(nil))
+
+	// verify the archive checksum
+	if archive.Spec.Checksum != nil {
+		expected := archive.Spec.Checksum.SHA256
+		if expected == "" && archive.Spec.Checksum.URL != "" {
+			checksumsURL, err := url.Parse(archive.Spec.Checksum.URL)
+			if err != nil {
+				err = fmt.Errorf("checksums file error: %w", err)
+				return sourcev1.HTTPArchiveNotReady(archive, sourcev1.URLInvalidReason, err.Error()), err
+			}
+			d := anonymous
+			if checksumsURL.Scheme == u.Scheme && checksumsURL.Host == u.Host {
+				d = creds
+			}
+			var buf bytes.Buffer
+			if _, err := d.download(checksumsURL.String(), &buf, maxChecksumsFileSize); err != nil {
+				err = fmt.Errorf("checksums file error: %w", err)
+				return sourcev1.HTTPArchiveNotReady(archive, sourcev1.DownloadFailedReason, err.Error()), err
+			}
+			expected, err = checksum.FromChecksumsFile(buf.Bytes(), path.Base(u.Path))
+			if err != nil {
+				err = fmt.Errorf("checksums file error: %w", err)
+				return sourcev1.HTTPArchiveNotReady(archive, sourcev1.VerificationFailedReason, err.Error()), err
+			}
+		}
+		if err := checksum.VerifySum(revision, expected); err != nil {
+			err = fmt.Errorf("archive verification error: %w", err)
+			return sourcev1.HTTPArchiveNotReady(archive, sourcev1.VerificationFailedReason, err.Error()), err
+		}
+	}
+
+	// extract the archive
+	contentDir := filepath.Join(tmpDir, "content")
+	if err := r.extract(f, size, contentDir); err != nil {
+		err = fmt.Errorf("failed to extract archive: %w", err)
+		return sourcev1.HTTPArchiveNotReady(archive, sourcev1.DownloadFailedReason, err.Error()), err
+	}
+
+	artifact := r.Storage.ArtifactFor(archive.Kind, archive.ObjectMeta.GetObjectMeta(),
+		fmt.Sprintf("%s.tar.gz", revision), revision)
+
+	// create artifact dir
+	err = r.Storage.MkdirAll(artifact)
+	if err != nil {
+		err = fmt.Errorf("mkdir dir error: %w", err)
+		return sourcev1.HTTPArchiveNotReady(archive, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// acquire lock
+	unlock, err := r.Storage.Lock(artifact)
+	if err != nil {
+		err = fmt.Errorf("unable to acquire lock: %w", err)
+		return sourcev1.HTTPArchiveNotReady(archive, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer unlock()
+
+	// determine the ignore patterns, the files are included unless
+	// excluded by the spec or the .sourceignore file
+	var ps []gitignore.Pattern
+	if archive.Spec.Ignore != nil {
+		ps = sourceignore.ReadPatterns(strings.NewReader(*archive.Spec.Ignore), nil)
+	}
+	filePatterns, err := sourceignore.ReadIgnoreFile(filepath.Join(contentDir, sourceignore.IgnoreFile), nil)
+	if err != nil {
+		err = fmt.Errorf("failed to read '%s': %w", sourceignore.IgnoreFile, err)
+		return sourcev1.HTTPArchiveNotReady(archive, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	ps = append(ps, filePatterns...)
+
+	// archive artifact
+	err = r.Storage.Archive(&artifact, contentDir, ps)
+	if err != nil {
+		err = fmt.Errorf("storage archive error: %w", err)
+		return sourcev1.HTTPArchiveNotReady(archive, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// update latest symlink
+	url, err := r.Storage.Symlink(artifact, "latest.tar.gz")
+	if err != nil {
+		err = fmt.Errorf("storage symlink error: %w", err)
+		return sourcev1.HTTPArchiveNotReady(archive, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	message := fmt.Sprintf("HTTP archive artifacts are available at: %s", artifact.Path)
+	return sourcev1.HTTPArchiveReady(archive, artifact, url, sourcev1.DownloadSucceededReason, message), nil
+}
+
+// extract detects the archive format from its content and extracts
+// the tar.gz or zip archive of the given size into dir.
+func (r *HTTPArchiveReconciler) extract(f *os.File, size int64, dir string) error {
+	magic := make([]byte, 4)
+	n, err := f.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	magic = magic[:n]
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return untar.Untar(io.NewSectionReader(f, 0, size), dir)
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")), bytes.HasPrefix(magic, []byte("PK\x05\x06")):
+		return unzip.Unzip(f, size, dir)
+	}
+	return fmt.Errorf("unsupported archive format, expected tar.gz or zip")
+}
+
+const (
+	// DefaultMaxArchiveSize is the maximum size of the archives downloaded
+	// by the reconcilers with no MaxArchiveSize set, 512MiB.
+	DefaultMaxArchiveSize int64 = 512 << 20
+
+	// maxChecksumsFileSize is the maximum size of the checksums files.
+	maxChecksumsFileSize int64 = 1 << 20
+)
+
+// downloader downloads files over HTTP/S with the basic auth credentials
+// and the TLS config it holds.
+type downloader struct {
+	client             *http.Client
+	username, password string
+}
+
+// downloadersFromSecret returns the downloader with the basic auth and
+// TLS credentials of the secret, and the one for the other hosts, only
+// trusting its CA certificates.
+func downloadersFromSecret(secret corev1.Secret) (downloader, downloader, error) {
+	var creds, anonymous downloader
+	username, password := string(secret.Data["username"]), string(secret.Data["password"])
+	if (username == "") != (password == "") {
+		return creds, anonymous, fmt.Errorf("invalid '%s' secret data: required fields 'username' and 'password'", secret.Name)
+	}
+	creds.username, creds.password = username, password
+
+	config, err := intgit.TLSConfigFromSecret(secret)
+	if err != nil {
+		return creds, anonymous, err
+	}
+	if config != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		creds.client = &http.Client{Transport: transport}
+
+		transport = transport.Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: config.RootCAs}
+		anonymous.client = &http.Client{Transport: transport}
+	}
+	return creds, anonymous, nil
+}
+
+// download streams the file of the URL to w, and returns its size. Files
+// larger than maxSize bytes are rejected.
+func (d downloader) download(u string, w io.Writer, maxSize int64) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	if d.username != "" {
+		req.SetBasicAuth(d.username, d.password)
+	}
+	c := d.client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to download '%s', status: %s", u, res.Status)
+	}
+
+	if res.ContentLength > maxSize {
+		return 0, fmt.Errorf("'%s' exceeds the maximum size of %d bytes", u, maxSize)
+	}
+	n, err := io.Copy(w, io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return n, fmt.Errorf("failed to download '%s': %w", u, err)
+	}
+	if n > maxSize {
+		return n, fmt.Errorf("'%s' exceeds the maximum size of %d bytes", u, maxSize)
+	}
+	return n, nil
+}
+
+func (r *HTTPArchiveReconciler) shouldResetStatus(archive sourcev1.HTTPArchive) (bool, sourcev1.HTTPArchiveStatus) {
+	resetStatus := false
+	if archive.Status.Artifact != nil {
+		if !r.Storage.ArtifactExist(*archive.Status.Artifact) {
+			resetStatus = true
+		}
+	}
+
+	if len(archive.Status.Conditions) == 0 || resetStatus {
+		resetStatus = true
+	}
+
+	return resetStatus, sourcev1.HTTPArchiveStatus{
+		Conditions: []sourcev1.SourceCondition{
+			{
+				Type:               sourcev1.ReadyCondition,
+				Status:             corev1.ConditionUnknown,
+				Reason:             sourcev1.InitializingReason,
+				LastTransitionTime: metav1.Now(),
+			},
+		},
+	}
+}
+
+func (r *HTTPArchiveReconciler) gc(archive sourcev1.HTTPArchive) error {
+	if archive.Status.Artifact != nil {
+		return r.Storage.RemoveAllButCurrent(*archive.Status.Artifact)
+	}
+	return nil
+}
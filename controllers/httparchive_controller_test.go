@@ -0,0 +1,327 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
+	"github.com/fluxcd/source-controller/internal/checksum"
+)
+
+// testClient returns a fake client serving the objects.
+func testClient(t *testing.T, objs ...runtime.Object) client.Client {
+	if err := sourcev1.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewFakeClientWithScheme(scheme.Scheme, objs...)
+}
+
+// testStorage returns a storage in a new tmp dir, the caller removes
+// its base path.
+func testStorage(t *testing.T) *Storage {
+	tmp, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage, err := NewStorage(tmp, "localhost", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+// readyCondition returns the ready condition of the conditions.
+func readyCondition(conditions []sourcev1.SourceCondition) sourcev1.SourceCondition {
+	for _, condition := range conditions {
+		if condition.Type == sourcev1.ReadyCondition {
+			return condition
+		}
+	}
+	return sourcev1.SourceCondition{}
+}
+
+func TestHTTPArchiveReconciler_maliciousArchive(t *testing.T) {
+	// the tarball links 'a/up/up2' to the parent of the extraction dir
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, header := range []*tar.Header{
+		{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "a/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "a/up/up2", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "a/up/up2/pwned", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := tw.Write([]byte("evil")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	// extract the archive in a dir of our own
+	tmp, err := ioutil.TempDir("", "tmpdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer os.Setenv("TMPDIR", os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmp)
+
+	archive := &sourcev1.HTTPArchive{
+		ObjectMeta: metav1.ObjectMeta{Name: "malicious", Namespace: "default"},
+		Spec: sourcev1.HTTPArchiveSpec{
+			URL:      server.URL + "/archive.tar.gz",
+			Interval: metav1.Duration{Duration: time.Minute},
+		},
+	}
+	r := &HTTPArchiveReconciler{
+		Client:  testClient(t, archive),
+		Log:     zap.New(zap.UseDevMode(true), zap.WriteTo(ioutil.Discard)),
+		Scheme:  scheme.Scheme,
+		Storage: testStorage(t),
+	}
+	defer os.RemoveAll(r.Storage.BasePath)
+
+	key := types.NamespacedName{Name: archive.Name, Namespace: archive.Namespace}
+	res, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	if err == nil || !res.Requeue {
+		t.Errorf("Reconcile() = %+v, %v, want the sync error requeued", res, err)
+	}
+
+	var got sourcev1.HTTPArchive
+	if err := r.Get(context.TODO(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	condition := readyCondition(got.Status.Conditions)
+	if condition.Status != corev1.ConditionFalse || condition.Reason != sourcev1.DownloadFailedReason ||
+		!strings.Contains(condition.Message, "outside of the target directory") {
+		t.Errorf("Reconcile() condition = %+v, want the archive rejected", condition)
+	}
+	if got.Status.Artifact != nil {
+		t.Errorf("Reconcile() artifact = %+v, want none", got.Status.Artifact)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "pwned")); !os.IsNotExist(err) {
+		t.Errorf("Reconcile() wrote outside of the extraction dir: %v", err)
+	}
+}
+
+// testTarGz returns a tar.gz archive of the files.
+func testTarGz(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// reconcileTest reconciles the archive, and returns it once reconciled.
+func (r *HTTPArchiveReconciler) reconcileTest(t *testing.T, archive *sourcev1.HTTPArchive) (sourcev1.HTTPArchive, error) {
+	key := types.NamespacedName{Name: archive.Name, Namespace: archive.Namespace}
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+
+	var got sourcev1.HTTPArchive
+	if err := r.Get(context.TODO(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	return got, err
+}
+
+func TestHTTPArchiveReconciler_ignore(t *testing.T) {
+	data := testTarGz(t, map[string]string{
+		"deploy.yaml":       "kind: Deployment\n",
+		"logo.png":          "png",
+		"release.zip":       "zip",
+		"docs/README.md":    "docs",
+		".sourceignore":     "/docs/\n",
+		"tests/values.yaml": "test: true\n",
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	ignore := "/tests/\n"
+	archive := &sourcev1.HTTPArchive{
+		ObjectMeta: metav1.ObjectMeta{Name: "ignore", Namespace: "default"},
+		Spec: sourcev1.HTTPArchiveSpec{
+			URL:      server.URL + "/archive.tar.gz",
+			Interval: metav1.Duration{Duration: time.Minute},
+			Ignore:   &ignore,
+		},
+	}
+	r := &HTTPArchiveReconciler{
+		Client:  testClient(t, archive),
+		Log:     zap.New(zap.UseDevMode(true), zap.WriteTo(ioutil.Discard)),
+		Scheme:  scheme.Scheme,
+		Storage: testStorage(t),
+	}
+	defer os.RemoveAll(r.Storage.BasePath)
+	got, err := r.reconcileTest(t, archive)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got.Status.Artifact == nil {
+		t.Fatal("Reconcile() artifact = nil")
+	}
+
+	var names []string
+	for name := range archiveEntries(t, got.Status.Artifact.Path) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := ".sourceignore,deploy.yaml,logo.png,release.zip"; strings.Join(names, ",") != want {
+		t.Errorf("Reconcile() archived %v, want %s", names, want)
+	}
+}
+
+func TestHTTPArchiveReconciler_maxSize(t *testing.T) {
+	data := testTarGz(t, map[string]string{"deploy.yaml": strings.Repeat("x", 4096)})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	archive := &sourcev1.HTTPArchive{
+		ObjectMeta: metav1.ObjectMeta{Name: "large", Namespace: "default"},
+		Spec: sourcev1.HTTPArchiveSpec{
+			URL:      server.URL + "/archive.tar.gz",
+			Interval: metav1.Duration{Duration: time.Minute},
+		},
+	}
+	r := &HTTPArchiveReconciler{
+		Client:         testClient(t, archive),
+		Log:            zap.New(zap.UseDevMode(true), zap.WriteTo(ioutil.Discard)),
+		Scheme:         scheme.Scheme,
+		Storage:        testStorage(t),
+		MaxArchiveSize: int64(len(data) - 1),
+	}
+	defer os.RemoveAll(r.Storage.BasePath)
+	got, err := r.reconcileTest(t, archive)
+	if err == nil {
+		t.Fatal("Reconcile() error = nil, want the archive size rejected")
+	}
+	if condition := readyCondition(got.Status.Conditions); condition.Reason != sourcev1.DownloadFailedReason ||
+		!strings.Contains(condition.Message, "exceeds the maximum size") {
+		t.Errorf("Reconcile() condition = %+v, want the archive size rejected", condition)
+	}
+}
+
+func TestHTTPArchiveReconciler_checksumCredentials(t *testing.T) {
+	data := testTarGz(t, map[string]string{"deploy.yaml": "kind: Deployment\n"})
+	checksums := checksum.SHA256(data) + "  archive.tar.gz\n"
+
+	// the archive host requires the credentials, the other host records
+	// the credentials it gets
+	archiveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/archive.tar.gz":
+			w.Write(data)
+		case "/checksums.txt":
+			w.Write([]byte(checksums))
+		}
+	}))
+	defer archiveServer.Close()
+	var otherAuth string
+	otherServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherAuth = r.Header.Get("Authorization")
+		w.Write([]byte(checksums))
+	}))
+	defer otherServer.Close()
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"},
+		Data:       map[string][]byte{"username": []byte("user"), "password": []byte("pass")},
+	}
+	for _, checksumsURL := range []string{archiveServer.URL + "/checksums.txt", otherServer.URL + "/checksums.txt"} {
+		archive := &sourcev1.HTTPArchive{
+			ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: "default"},
+			Spec: sourcev1.HTTPArchiveSpec{
+				URL:       archiveServer.URL + "/archive.tar.gz",
+				Checksum:  &sourcev1.HTTPArchiveChecksum{URL: checksumsURL},
+				SecretRef: &corev1.LocalObjectReference{Name: secret.Name},
+				Interval:  metav1.Duration{Duration: time.Minute},
+			},
+		}
+		r := &HTTPArchiveReconciler{
+			Client:  testClient(t, archive, secret),
+			Log:     zap.New(zap.UseDevMode(true), zap.WriteTo(ioutil.Discard)),
+			Scheme:  scheme.Scheme,
+			Storage: testStorage(t),
+		}
+		defer os.RemoveAll(r.Storage.BasePath)
+		if _, err := r.reconcileTest(t, archive); err != nil {
+			t.Errorf("Reconcile() error = %v for checksums file %s", err, checksumsURL)
+		}
+	}
+	if otherAuth != "" {
+		t.Errorf("Reconcile() sent the credentials to the checksums file host: %s", otherAuth)
+	}
+}
@@ -0,0 +1,292 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
+	"github.com/fluxcd/source-controller/internal/oci"
+)
+
+// OCIRepositoryReconciler reconciles a OCIRepository object
+type OCIRepositoryReconciler struct {
+	client.Client
+	Log     logr.Logger
+	Scheme  *runtime.Scheme
+	Storage *Storage
+}
+
+// +kubebuilder:rbac:groups=source.fluxcd.io,resources=ocirepositories,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=source.fluxcd.io,resources=ocirepositories/status,verbs=get;update;patch
+
+func (r *OCIRepositoryReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var repository sourcev1.OCIRepository
+	if err := r.Get(ctx, req.NamespacedName, &repository); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	log := r.Log.WithValues(repository.Kind, req.NamespacedName)
+
+	// set initial status
+	if reset, status := r.shouldResetStatus(repository); reset {
+		log.Info("Initializing OCI repository")
+		repository.Status = status
+		if err := r.Status().Update(ctx, &repository); err != nil {
+			log.Error(err, "unable to update OCIRepository status")
+			return ctrl.Result{Requeue: true}, err
+		}
+	}
+
+	// try to remove old artifacts
+	if err := r.gc(repository); err != nil {
+		log.Error(err, "artifacts GC failed")
+	}
+
+	// try to pull the artifact
+	syncedRepo, syncErr := r.sync(*repository.DeepCopy())
+	if syncErr != nil {
+		log.Error(syncErr, "OCI repository sync failed")
+	}
+
+	// update status
+	if err := r.Status().Update(ctx, &syncedRepo); err != nil {
+		log.Error(err, "unable to update OCIRepository status")
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	if syncErr != nil {
+		return ctrl.Result{Requeue: true}, syncErr
+	}
+
+	log.Info("OCI repository sync succeeded", "msg", sourcev1.OCIRepositoryReadyMessage(syncedRepo))
+
+	// requeue repository
+	return ctrl.Result{RequeueAfter: repository.GetInterval().Duration}, nil
+}
+
+func (r *OCIRepositoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&sourcev1.OCIRepository{}).
+		WithEventFilter(SourceChangePredicate{}).
+		WithEventFilter(GarbageCollectPredicate{Scheme: r.Scheme, Log: r.Log, Storage: r.Storage}).
+		Complete(r)
+}
+
+func (r *OCIRepositoryReconciler) sync(repository sourcev1.OCIRepository) (sourcev1.OCIRepository, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), repository.GetTimeout().Duration)
+	defer cancel()
+
+	registry, err := oci.ParseRepository(repository.Spec.URL)
+	if err != nil {
+		return sourcev1.OCIRepositoryNotReady(repository, sourcev1.URLInvalidReason, err.Error()), err
+	}
+
+	c := oci.NewClient("", "")
+	c.HTTPClient = &http.Client{Timeout: repository.GetTimeout().Duration}
+	c.PlainHTTP = repository.Spec.Insecure
+
+	// determine credentials
+	if repository.Spec.SecretRef != nil {
+		name := types.NamespacedName{
+			Namespace: repository.GetNamespace(),
+			Name:      repository.Spec.SecretRef.Name,
+		}
+
+		var secret corev1.Secret
+		err := r.Client.Get(ctx, name, &secret)
+		if err != nil {
+			err = fmt.Errorf("auth secret error: %w", err)
+			return sourcev1.OCIRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
+		}
+
+		username, password, err := oci.CredentialsFromSecret(secret, registry.Host)
+		if err != nil {
+			err = fmt.Errorf("auth error: %w", err)
+			return sourcev1.OCIRepositoryNotReady(repository, sourcev1.AuthenticationFailedReason, err.Error()), err
+		}
+		c.Username, c.Password = username, password
+	}
+
+	// resolve the reference to a tag or digest
+	reference, err := r.reference(ctx, c, registry, repository.Spec.Reference)
+	if err != nil {
+		return sourcev1.OCIRepositoryNotReady(repository, r.reason(err), err.Error()), err
+	}
+
+	// pull the manifest
+	manifest, digest, err := c.Manifest(ctx, registry, reference)
+	if err != nil {
+		err = fmt.Errorf("failed to get manifest of '%s' for reference '%s': %w", registry, reference, err)
+		return sourcev1.OCIRepositoryNotReady(repository, r.reason(err), err.Error()), err
+	}
+
+	var mediaType string
+	if repository.Spec.LayerSelector != nil {
+		mediaType = repository.Spec.LayerSelector.MediaType
+	}
+	layer, err := manifest.Layer(mediaType)
+	if err != nil {
+		err = fmt.Errorf("'%s' error: %w", registry, err)
+		return sourcev1.OCIRepositoryNotReady(repository, sourcev1.OCIOperationFailedReason, err.Error()), err
+	}
+
+	// pull the layer to a tmp file
+	tmpFile, err := ioutil.TempFile("", repository.Name)
+	if err != nil {
+		err = fmt.Errorf("tmp file error: %w", err)
+		return sourcev1.OCIRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+	if err := c.Blob(ctx, registry, layer.Digest, tmpFile); err != nil {
+		err = fmt.Errorf("failed to pull layer '%s': %w", layer.Digest, err)
+		return sourcev1.OCIRepositoryNotReady(repository, r.reason(err), err.Error()), err
+	}
+
+	// the layer is published as a tar.gz artifact, whatever its media type
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		err = fmt.Errorf("tmp file error: %w", err)
+		return sourcev1.OCIRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	if err := oci.VerifyTarGzip(tmpFile); err != nil {
+		err = fmt.Errorf("layer '%s' of media type '%s' is not a tar.gz archive: %w", layer.Digest, layer.MediaType, err)
+		return sourcev1.OCIRepositoryNotReady(repository, sourcev1.OCIOperationFailedReason, err.Error()), err
+	}
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		err = fmt.Errorf("tmp file error: %w", err)
+		return sourcev1.OCIRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	artifact := r.Storage.ArtifactFor(repository.Kind, repository.ObjectMeta.GetObjectMeta(),
+		fmt.Sprintf("%s.tar.gz", strings.TrimPrefix(digest, "sha256:")), digest)
+
+	// create artifact dir
+	err = r.Storage.MkdirAll(artifact)
+	if err != nil {
+		err = fmt.Errorf("mkdir dir error: %w", err)
+		return sourcev1.OCIRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// acquire lock
+	unlock, err := r.Storage.Lock(artifact)
+	if err != nil {
+		err = fmt.Errorf("unable to acquire lock: %w", err)
+		return sourcev1.OCIRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+	defer unlock()
+
+	// save artifact to storage
+	err = r.Storage.Copy(&artifact, tmpFile)
+	if err != nil {
+		err = fmt.Errorf("storage write error: %w", err)
+		return sourcev1.OCIRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	// update latest symlink
+	url, err := r.Storage.Symlink(artifact, "latest.tar.gz")
+	if err != nil {
+		err = fmt.Errorf("storage symlink error: %w", err)
+		return sourcev1.OCIRepositoryNotReady(repository, sourcev1.StorageOperationFailedReason, err.Error()), err
+	}
+
+	message := fmt.Sprintf("OCI artifact is available at: %s", artifact.Path)
+	return sourcev1.OCIRepositoryReady(repository, artifact, url, sourcev1.OCIOperationSucceedReason, message), nil
+}
+
+// reference returns the tag or digest to pull, resolving a semver
+// expression against the tags of the repository.
+func (r *OCIRepositoryReconciler) reference(ctx context.Context, c *oci.Client, registry oci.Repository,
+	ref *sourcev1.OCIRepositoryRef) (string, error) {
+	switch {
+	case ref == nil:
+		return "latest", nil
+	case ref.Digest != "":
+		return ref.Digest, nil
+	case ref.SemVer != "":
+		tags, err := c.Tags(ctx, registry)
+		if err != nil {
+			return "", fmt.Errorf("failed to list tags of '%s': %w", registry, err)
+		}
+		tag, err := oci.LatestTag(tags, ref.SemVer)
+		if err != nil {
+			return "", fmt.Errorf("'%s' error: %w", registry, err)
+		}
+		return tag, nil
+	case ref.Tag != "":
+		return ref.Tag, nil
+	}
+	return "latest", nil
+}
+
+// reason returns the condition reason for a registry error.
+func (r *OCIRepositoryReconciler) reason(err error) string {
+	if errors.Is(err, oci.ErrUnauthorized) {
+		return sourcev1.AuthenticationFailedReason
+	}
+	return sourcev1.OCIOperationFailedReason
+}
+
+func (r *OCIRepositoryReconciler) shouldResetStatus(repository sourcev1.OCIRepository) (bool, sourcev1.OCIRepositoryStatus) {
+	resetStatus := false
+	if repository.Status.Artifact != nil {
+		if !r.Storage.ArtifactExist(*repository.Status.Artifact) {
+			resetStatus = true
+		}
+	}
+
+	if len(repository.Status.Conditions) == 0 || resetStatus {
+		resetStatus = true
+	}
+
+	return resetStatus, sourcev1.OCIRepositoryStatus{
+		Conditions: []sourcev1.SourceCondition{
+			{
+				Type:               sourcev1.ReadyCondition,
+				Status:             corev1.ConditionUnknown,
+				Reason:             sourcev1.InitializingReason,
+				LastTransitionTime: metav1.Now(),
+			},
+		},
+	}
+}
+
+func (r *OCIRepositoryReconciler) gc(repository sourcev1.OCIRepository) error {
+	if repository.Status.Artifact != nil {
+		return r.Storage.RemoveAllButCurrent(*repository.Status.Artifact)
+	}
+	return nil
+}
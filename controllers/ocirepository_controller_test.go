@@ -0,0 +1,127 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
+	"github.com/fluxcd/source-controller/internal/oci/ocitest"
+)
+
+const testContentMediaType = "application/vnd.cncf.flux.content.v1.tar+gzip"
+
+// reconcileTest reconciles the repository, and returns it once reconciled.
+func (r *OCIRepositoryReconciler) reconcileTest(t *testing.T, repository *sourcev1.OCIRepository) (sourcev1.OCIRepository, error) {
+	key := types.NamespacedName{Name: repository.Name, Namespace: repository.Namespace}
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+
+	var got sourcev1.OCIRepository
+	if err := r.Get(context.TODO(), key, &got); err != nil {
+		t.Fatal(err)
+	}
+	return got, err
+}
+
+func TestOCIRepositoryReconciler(t *testing.T) {
+	registry := ocitest.NewRegistry("user", "pass")
+	defer registry.Close()
+	registry.Push("1.0.0", testContentMediaType, testTarGz(t, map[string]string{"deploy.yaml": "version: 1.0.0\n"}))
+	digest := registry.Push("1.1.0", testContentMediaType, testTarGz(t, map[string]string{"deploy.yaml": "version: 1.1.0\n"}))
+	registry.Push("2.0.0", testContentMediaType, testTarGz(t, map[string]string{"deploy.yaml": "version: 2.0.0\n"}))
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "credentials", Namespace: "default"},
+		Data:       map[string][]byte{"username": []byte("user"), "password": []byte("pass")},
+	}
+	repository := &sourcev1.OCIRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "default"},
+		Spec: sourcev1.OCIRepositorySpec{
+			URL:       "oci://" + registry.Host() + "/manifests/podinfo",
+			Reference: &sourcev1.OCIRepositoryRef{SemVer: "1.x"},
+			SecretRef: &corev1.LocalObjectReference{Name: secret.Name},
+			Insecure:  true,
+			Interval:  metav1.Duration{Duration: time.Minute},
+		},
+	}
+	r := &OCIRepositoryReconciler{
+		Client:  testClient(t, repository, secret),
+		Log:     zap.New(zap.UseDevMode(true), zap.WriteTo(ioutil.Discard)),
+		Scheme:  scheme.Scheme,
+		Storage: testStorage(t),
+	}
+	defer os.RemoveAll(r.Storage.BasePath)
+
+	// the semver range selects the latest matching tag
+	got, err := r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	artifact := got.Status.Artifact
+	if artifact == nil || artifact.Revision != digest || !r.Storage.ArtifactExist(*artifact) {
+		t.Fatalf("Reconcile() artifact = %+v, want an existing artifact of %s", artifact, digest)
+	}
+	if entries := archiveEntries(t, artifact.Path); entries["deploy.yaml"] != "version: 1.1.0\n" {
+		t.Errorf("Reconcile() archive entries = %v, want the layer of 1.1.0", entries)
+	}
+
+	// a new matching tag is a new revision
+	digest = registry.Push("1.2.0", testContentMediaType, testTarGz(t, map[string]string{"deploy.yaml": "version: 1.2.0\n"}))
+	got, err = r.reconcileTest(t, repository)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if got.Status.Artifact == nil || got.Status.Artifact.Revision != digest {
+		t.Errorf("Reconcile() artifact = %+v, want the revision %s", got.Status.Artifact, digest)
+	}
+
+	// a layer that is not a tar.gz archive is rejected
+	registry.Push("1.3.0", testContentMediaType, []byte("not an archive"))
+	got, err = r.reconcileTest(t, repository)
+	if err == nil {
+		t.Fatal("Reconcile() expected error for the invalid layer")
+	}
+	if condition := readyCondition(got.Status.Conditions); condition.Status != corev1.ConditionFalse ||
+		condition.Reason != sourcev1.OCIOperationFailedReason {
+		t.Errorf("Reconcile() condition = %+v, want the layer rejected", condition)
+	}
+
+	// the wrong credentials are rejected
+	secret.Data["password"] = []byte("other")
+	if err := r.Update(context.TODO(), secret); err != nil {
+		t.Fatal(err)
+	}
+	got, err = r.reconcileTest(t, repository)
+	if err == nil {
+		t.Fatal("Reconcile() expected error for the wrong credentials")
+	}
+	if condition := readyCondition(got.Status.Conditions); condition.Status != corev1.ConditionFalse ||
+		condition.Reason != sourcev1.AuthenticationFailedReason {
+		t.Errorf("Reconcile() condition = %+v, want the authentication failed", condition)
+	}
+}
@@ -24,6 +24,8 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
 )
 
 type SourceChangePredicate struct {
@@ -60,6 +62,33 @@ const (
 	ForceSyncAnnotation string = "source.fluxcd.io/syncAt"
 )
 
+type ArtifactChangePredicate struct {
+	predicate.Funcs
+}
+
+// Update implements the UpdateEvent filter for sources
+// with a new artifact revision or checksum.
+func (ArtifactChangePredicate) Update(e event.UpdateEvent) bool {
+	oldSource, ok := e.ObjectOld.(sourcev1.Source)
+	if !ok {
+		return false
+	}
+	newSource, ok := e.ObjectNew.(sourcev1.Source)
+	if !ok {
+		return false
+	}
+
+	oldArtifact, newArtifact := oldSource.GetArtifact(), newSource.GetArtifact()
+	if newArtifact == nil {
+		return false
+	}
+	if oldArtifact == nil {
+		return true
+	}
+	return oldArtifact.Revision != newArtifact.Revision ||
+		oldArtifact.Checksum != newArtifact.Checksum
+}
+
 type GarbageCollectPredicate struct {
 	predicate.Funcs
 	Scheme  *runtime.Scheme
@@ -17,20 +17,26 @@ limitations under the License.
 package controllers
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"context"
 	"crypto/sha1"
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
 	"github.com/fluxcd/source-controller/internal/lockedfile"
+	"github.com/fluxcd/source-controller/internal/symlink"
+	"github.com/fluxcd/source-controller/internal/untar"
 )
 
 // Storage manages artifacts
@@ -90,6 +96,9 @@ func (s *Storage) RemoveAllButCurrent(artifact sourcev1.Artifact) error {
 	dir := filepath.Dir(artifact.Path)
 	errors := []string{}
 	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
 		if path != artifact.Path && !info.IsDir() && info.Mode()&os.ModeSymlink != os.ModeSymlink {
 			if err := os.Remove(path); err != nil {
 				errors = append(errors, info.Name())
@@ -104,6 +113,33 @@ func (s *Storage) RemoveAllButCurrent(artifact sourcev1.Artifact) error {
 	return nil
 }
 
+// RemoveAllButNames removes all entries of the given artifact base dir excluding the named ones
+func (s *Storage) RemoveAllButNames(artifact sourcev1.Artifact, names map[string]bool) error {
+	dir := filepath.Dir(artifact.Path)
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	errors := []string{}
+	for _, entry := range entries {
+		if names[entry.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			errors = append(errors, entry.Name())
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("faild to remove files: %s", strings.Join(errors, " "))
+	}
+	return nil
+}
+
 // ArtifactExist returns a boolean indicating whether the artifact file exists in storage
 func (s *Storage) ArtifactExist(artifact sourcev1.Artifact) bool {
 	if _, err := os.Stat(artifact.Path); os.IsNotExist(err) {
@@ -112,28 +148,164 @@ func (s *Storage) ArtifactExist(artifact sourcev1.Artifact) bool {
 	return true
 }
 
-// Archive creates a tar.gz to the artifact path from the given dir excluding the provided file extensions
-func (s *Storage) Archive(artifact sourcev1.Artifact, dir string, excludes string) error {
-	if excludes == "" {
-		excludes = "jpg,jpeg,gif,png,wmv,flv,tar.gz,zip"
-	}
+// Archive creates a tar.gz to the artifact path from the given dir excluding
+// the files matching the ignore patterns and the .git dirs, and sets the
+// artifact checksum. Symlinks are archived as links and must point to a path inside
+// the dir. The archive is reproducible, the same dir content always results
+// in the same archive bytes.
+func (s *Storage) Archive(artifact *sourcev1.Artifact, dir string, ps []gitignore.Pattern) error {
+	matcher := gitignore.NewMatcher(ps)
 
 	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
 	defer cancel()
 
-	tarExcludes := fmt.Sprintf("--exclude=\\*.{%s} --exclude .git", excludes)
-	cmd := fmt.Sprintf("cd %s && tar -c %s -f - . | gzip > %s", dir, tarExcludes, artifact.Path)
-	command := exec.CommandContext(ctx, "/bin/sh", "-c", cmd)
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	// the links are resolved against the real root path
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+
+	// write to a tmp file in the artifact dir and rename it on success,
+	// so the artifact is never served half written
+	tmp, err := ioutil.TempFile(filepath.Dir(artifact.Path), filepath.Base(artifact.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	// the gzip header is left without name and mod time, and the walk
+	// visits the files in lexical order
+	h := sha256.New()
+	zw := gzip.NewWriter(io.MultiWriter(tmp, h))
+	tw := tar.NewWriter(zw)
+	err = filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk error on '%s': %w", p, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if fi.Name() == ".git" || matcher.Match(strings.Split(filepath.ToSlash(rel), "/"), fi.IsDir()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return archiveFile(tw, root, p, fi)
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmpName, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, artifact.Path); err != nil {
+		return err
+	}
+	artifact.Checksum = fmt.Sprintf("%x", h.Sum(nil))
+	return nil
+}
+
+// archiveFile writes the header and content of the file at path p to
+// the tar writer, with the name relative to root. The header only keeps
+// the file type, size and executable bit, ownership and timestamps are
+// normalized.
+func archiveFile(tw *tar.Writer, root, p string, fi os.FileInfo) error {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return err
+	}
+
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(p); err != nil {
+			return fmt.Errorf("failed to read symlink '%s': %w", rel, err)
+		}
+		// the link is resolved as the kernel would, through the other
+		// links of the dir, rather than lexically
+		target, err := symlink.Eval(p)
+		if err != nil {
+			return fmt.Errorf("failed to resolve symlink '%s': %w", rel, err)
+		}
+		if !symlink.Within(root, target) {
+			return fmt.Errorf("symlink '%s' points outside of the archive root", rel)
+		}
+		// absolute links are made relative so they resolve once extracted
+		if filepath.IsAbs(link) {
+			if link, err = filepath.Rel(filepath.Dir(p), target); err != nil {
+				return err
+			}
+		}
+	}
+
+	header := &tar.Header{
+		Name:    filepath.ToSlash(rel),
+		ModTime: time.Unix(0, 0).UTC(),
+	}
+	switch mode := fi.Mode(); {
+	case mode.IsDir():
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+		header.Mode = 0755
+	case mode&os.ModeSymlink != 0:
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = filepath.ToSlash(link)
+		header.Mode = 0777
+	case mode.IsRegular():
+		header.Typeflag = tar.TypeReg
+		header.Size = fi.Size()
+		header.Mode = 0644
+		if mode&0111 != 0 {
+			header.Mode = 0755
+		}
+	default:
+		// sockets, devices and named pipes have no place in an artifact
+		return nil
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write header for '%s': %w", rel, err)
+	}
 
-	err := command.Run()
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(p)
 	if err != nil {
-		return fmt.Errorf("command '%s' failed: %w", cmd, err)
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to archive '%s': %w", rel, err)
 	}
 	return nil
 }
 
-// WriteFile writes the given bytes to the artifact path if the checksum differs
-func (s *Storage) WriteFile(artifact sourcev1.Artifact, data []byte) error {
+// WriteFile writes the given bytes to the artifact path if the checksum differs,
+// and sets the artifact checksum
+func (s *Storage) WriteFile(artifact *sourcev1.Artifact, data []byte) error {
+	artifact.Checksum = fmt.Sprintf("%x", sha256.Sum256(data))
+
 	sum := s.Checksum(data)
 	if file, err := os.Stat(artifact.Path); !os.IsNotExist(err) && !file.IsDir() {
 		if fb, err := ioutil.ReadFile(artifact.Path); err == nil && sum == s.Checksum(fb) {
@@ -144,6 +316,160 @@ func (s *Storage) WriteFile(artifact sourcev1.Artifact, data []byte) error {
 	return ioutil.WriteFile(artifact.Path, data, 0644)
 }
 
+// Copy writes the content read from the reader to the artifact path,
+// through a temporary file renamed once complete, and sets the artifact
+// checksum
+func (s *Storage) Copy(artifact *sourcev1.Artifact, reader io.Reader) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(artifact.Path), ".tmp-"+filepath.Base(artifact.Path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), reader); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), artifact.Path); err != nil {
+		return err
+	}
+	artifact.Checksum = fmt.Sprintf("%x", h.Sum(nil))
+	return nil
+}
+
+// CopyToPath extracts the given sub path of the artifact into the to path,
+// paths escaping the artifact root or the target directory are confined
+// to them. The directories existing in the target directory are merged,
+// the files are never overwritten.
+func (s *Storage) CopyToPath(artifact sourcev1.Artifact, dir, subPath, toPath string) error {
+	f, err := os.Open(artifact.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tmp, err := ioutil.TempDir("", "artifact-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := untar.Untar(f, tmp); err != nil {
+		return err
+	}
+
+	fromPath := securePath(tmp, subPath)
+	if _, err := os.Stat(fromPath); err != nil {
+		return fmt.Errorf("path '%s' not found in artifact: %w", subPath, err)
+	}
+
+	target := securePath(dir, toPath)
+	if err := mkdirParents(dir, target); err != nil {
+		return fmt.Errorf("failed to copy to '%s': %w", toPath, err)
+	}
+	if err := mergeTree(fromPath, target); err != nil {
+		return fmt.Errorf("failed to copy to '%s': %w", toPath, err)
+	}
+	return nil
+}
+
+// securePath joins the path to the root, confining it to the root
+func securePath(root, path string) string {
+	return filepath.Join(root, filepath.Clean(string(filepath.Separator)+path))
+}
+
+// mkdirParents creates the missing parent directories of the path in the
+// root, it fails on the symlinks, which could point outside of the root.
+func mkdirParents(root, path string) error {
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil || rel == "." || path == root {
+		return err
+	}
+	dir := root
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, name)
+		fi, err := os.Lstat(dir)
+		switch {
+		case os.IsNotExist(err):
+			if err := os.Mkdir(dir, 0755); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case !fi.IsDir():
+			return fmt.Errorf("'%s' is not a directory", rel)
+		}
+	}
+	return nil
+}
+
+// mergeTree copies the tree of src to dst, merging the directories that
+// exist in both. It fails on the paths of src that exist in dst as files
+// or symlinks.
+func mergeTree(src, dst string) error {
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		existing, err := os.Lstat(target)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return err
+		case fi.IsDir() && existing.IsDir():
+			return nil
+		default:
+			return fmt.Errorf("'%s' already exists", filepath.ToSlash(rel))
+		}
+
+		switch {
+		case fi.IsDir():
+			return os.Mkdir(target, 0755)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case fi.Mode().IsRegular():
+			return copyFile(p, target, fi.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+// copyFile copies the src file to the new dst file.
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
 // Symlink creates or updates a symbolic link for the given artifact
 // and returns the URL for the symlink
 func (s *Storage) Symlink(artifact sourcev1.Artifact, linkName string) (string, error) {
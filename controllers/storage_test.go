@@ -0,0 +1,486 @@
+/*
+Copyright 2020 The Flux CD contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
+	"github.com/fluxcd/source-controller/internal/sourceignore"
+)
+
+func createFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func archiveEntries(t *testing.T, path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+
+	entries := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries[header.Name] = string(b)
+		case tar.TypeSymlink:
+			entries[header.Name] = "-> " + header.Linkname
+		default:
+			entries[header.Name] = ""
+		}
+	}
+}
+
+func TestStorage_Archive(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		symlinks map[string]string
+		ignore   string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name: "files and dirs",
+			files: map[string]string{
+				"deploy/app.yaml":     "kind: Deployment",
+				"dir with spaces/a b": "spaces",
+				"README.md":           "# app",
+			},
+			want: []string{"README.md", "deploy/", "deploy/app.yaml", "dir with spaces/", "dir with spaces/a b"},
+		},
+		{
+			name:   "default patterns and git",
+			ignore: sourceignore.DefaultIgnore,
+			files: map[string]string{
+				".git/HEAD":         "ref: refs/heads/master",
+				"sub/.git":          "gitdir: ../.git/modules/sub",
+				"logo.png":          "png",
+				"release.tar.gz":    "tgz",
+				"kustomization.yml": "resources: []",
+			},
+			want: []string{"kustomization.yml", "sub/"},
+		},
+		{
+			name:   "custom patterns",
+			files:  map[string]string{"a.txt": "a", "b.md": "b", "logo.png": "png", "docs/c.md": "c", "pkg/docs/d.md": "d"},
+			ignore: "*.txt\n/docs/\n",
+			want:   []string{"b.md", "logo.png", "pkg/", "pkg/docs/", "pkg/docs/d.md"},
+		},
+		{
+			name:   "negated pattern",
+			files:  map[string]string{"a.md": "a", "README.md": "readme", "deploy/app.yaml": "app"},
+			ignore: "*.md\n!README.md\n",
+			want:   []string{"README.md", "deploy/", "deploy/app.yaml"},
+		},
+		{
+			name:     "symlink inside root",
+			files:    map[string]string{"values.yaml": "replicas: 1"},
+			symlinks: map[string]string{"link.yaml": "values.yaml"},
+			want:     []string{"link.yaml", "values.yaml"},
+		},
+		{
+			name:     "symlink outside root",
+			files:    map[string]string{"values.yaml": "replicas: 1"},
+			symlinks: map[string]string{"passwd": "/etc/passwd"},
+			wantErr:  true,
+		},
+		{
+			name:     "relative symlink outside root",
+			files:    map[string]string{"values.yaml": "replicas: 1"},
+			symlinks: map[string]string{"up": "../outside"},
+			wantErr:  true,
+		},
+		{
+			name:     "chained symlinks outside root",
+			files:    map[string]string{"a/values.yaml": "replicas: 1"},
+			symlinks: map[string]string{"a/up": "..", "b": "a/up/.."},
+			wantErr:  true,
+		},
+		{
+			name:     "dangling symlink outside root",
+			files:    map[string]string{"values.yaml": "replicas: 1"},
+			symlinks: map[string]string{"self": ".", "missing": "self/../missing"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "archive")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			dir := filepath.Join(tmp, "source")
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			createFiles(t, dir, tt.files)
+			for name, target := range tt.symlinks {
+				if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			storage, err := NewStorage(tmp, "localhost", time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			artifact := sourcev1.Artifact{Path: filepath.Join(tmp, "artifact.tar.gz")}
+
+			ps := sourceignore.ReadPatterns(strings.NewReader(tt.ignore), nil)
+			err = storage.Archive(&artifact, dir, ps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Archive() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, err := os.Stat(artifact.Path); !os.IsNotExist(err) {
+					t.Errorf("Archive() left an artifact behind on error")
+				}
+				return
+			}
+
+			entries := archiveEntries(t, artifact.Path)
+			var got []string
+			for name := range entries {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Archive() entries = %v, want %v", got, tt.want)
+			}
+			for name, content := range tt.files {
+				if c, ok := entries[name]; ok && c != content {
+					t.Errorf("Archive() %s = %q, want %q", name, c, content)
+				}
+			}
+
+			matches, _ := filepath.Glob(artifact.Path + ".tmp*")
+			if len(matches) > 0 {
+				t.Errorf("Archive() left tmp files behind: %v", matches)
+			}
+		})
+	}
+}
+
+func TestStorage_ArchiveReproducible(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	storage, err := NewStorage(tmp, "localhost", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// archive the same content checked out at different times and
+	// with different file modes
+	var checksums []string
+	for i, mtime := range []time.Time{time.Now(), time.Now().Add(-24 * time.Hour)} {
+		dir := filepath.Join(tmp, fmt.Sprintf("source-%d", i))
+		createFiles(t, dir, map[string]string{
+			"deploy/app.yaml":   "kind: Deployment",
+			"deploy/svc.yaml":   "kind: Service",
+			"scripts/run.sh":    "#!/bin/sh",
+			"kustomization.yml": "resources: []",
+		})
+		if err := os.Chmod(filepath.Join(dir, "scripts/run.sh"), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(filepath.Join(dir, "deploy/app.yaml"), os.FileMode(0600+i*0044)); err != nil {
+			t.Fatal(err)
+		}
+		if err := filepath.Walk(dir, func(p string, _ os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Chtimes(p, mtime, mtime)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		artifact := sourcev1.Artifact{Path: filepath.Join(tmp, fmt.Sprintf("artifact-%d.tar.gz", i))}
+		if err := storage.Archive(&artifact, dir, nil); err != nil {
+			t.Fatalf("Archive() error = %v", err)
+		}
+
+		b, err := ioutil.ReadFile(artifact.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum := fmt.Sprintf("%x", sha256.Sum256(b)); artifact.Checksum != sum {
+			t.Errorf("Archive() checksum = %s, want %s", artifact.Checksum, sum)
+		}
+		checksums = append(checksums, artifact.Checksum)
+	}
+
+	if checksums[0] != checksums[1] {
+		t.Errorf("Archive() is not reproducible, got checksums %v", checksums)
+	}
+}
+
+func TestStorage_WriteFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "writefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	storage, err := NewStorage(tmp, "localhost", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("apiVersion: v1\nentries: {}\n")
+	artifact := sourcev1.Artifact{Path: filepath.Join(tmp, "index.yaml")}
+	if err := storage.WriteFile(&artifact, data); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if sum := fmt.Sprintf("%x", sha256.Sum256(data)); artifact.Checksum != sum {
+		t.Errorf("WriteFile() checksum = %s, want %s", artifact.Checksum, sum)
+	}
+}
+
+func TestStorage_Copy(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	storage, err := NewStorage(tmp, "localhost", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("layer")
+	artifact := sourcev1.Artifact{Path: filepath.Join(tmp, "layer.tar.gz")}
+	if err := storage.Copy(&artifact, bytes.NewReader(data)); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if sum := fmt.Sprintf("%x", sha256.Sum256(data)); artifact.Checksum != sum {
+		t.Errorf("Copy() checksum = %s, want %s", artifact.Checksum, sum)
+	}
+	if b, err := ioutil.ReadFile(artifact.Path); err != nil || !bytes.Equal(b, data) {
+		t.Errorf("Copy() wrote %q, %v, want %q", b, err, data)
+	}
+	if files, _ := ioutil.ReadDir(tmp); len(files) != 1 {
+		t.Errorf("Copy() left %d files, want 1", len(files))
+	}
+}
+
+func TestStorage_CopyToPath(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "copytopath")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	storage, err := NewStorage(tmp, "localhost", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(tmp, "src")
+	createFiles(t, src, map[string]string{
+		"deploy/app.yaml": "kind: Deployment",
+		"README.md":       "# platform",
+	})
+	artifact := sourcev1.Artifact{Path: filepath.Join(tmp, "platform.tar.gz")}
+	if err := storage.Archive(&artifact, src, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		fromPath string
+		toPath   string
+		existing map[string]string
+		want     string
+		wantErr  bool
+	}{
+		{"artifact root", "", "platform", nil, "platform/deploy/app.yaml", false},
+		{"sub path", "deploy", "bases/platform", nil, "bases/platform/app.yaml", false},
+		{"confined paths", "../../deploy", "../../escaped", nil, "escaped/app.yaml", false},
+		{"missing sub path", "missing", "missing", nil, "", true},
+		{"existing dir", "deploy", "deploy", map[string]string{"deploy/base.yaml": "kind: Namespace"}, "deploy/app.yaml", false},
+		{"repository root", "", "./", map[string]string{"deploy/base.yaml": "kind: Namespace"}, "deploy/app.yaml", false},
+		{"existing file", "", "./", map[string]string{"README.md": "# app"}, "", true},
+		{"existing file path", "deploy", "deploy", map[string]string{"deploy": "kind: Namespace"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(tmp, "checkout")
+			if err != nil {
+				t.Fatal(err)
+			}
+			createFiles(t, dir, tt.existing)
+			err = storage.CopyToPath(artifact, dir, tt.fromPath, tt.toPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CopyToPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for path, content := range tt.existing {
+				if b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(path))); err != nil || string(b) != content {
+					t.Errorf("CopyToPath() existing %s = %q, %v, want %q", path, b, err, content)
+				}
+			}
+			if tt.want == "" {
+				return
+			}
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(tt.want))); err != nil {
+				t.Errorf("CopyToPath() expected %s: %v", tt.want, err)
+			}
+		})
+	}
+
+	// the symlinks of the checkout are not followed
+	dir, err := ioutil.TempDir(tmp, "checkout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(tmp, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	for _, toPath := range []string{"link", "link/platform"} {
+		if err := storage.CopyToPath(artifact, dir, "deploy", toPath); err == nil {
+			t.Errorf("CopyToPath() to %s expected error", toPath)
+		}
+	}
+	if entries, err := ioutil.ReadDir(outside); err != nil || len(entries) != 0 {
+		t.Errorf("CopyToPath() wrote %d files through the symlink, %v", len(entries), err)
+	}
+}
+
+func TestStorage_RemoveAllButCurrent(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "removeallbutcurrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	storage, err := NewStorage(tmp, "localhost", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createFiles(t, filepath.Join(tmp, "repo"), map[string]string{
+		"a.tar.gz": "a",
+		"b.tar.gz": "b",
+	})
+	artifact := sourcev1.Artifact{Path: filepath.Join(tmp, "repo", "b.tar.gz")}
+	if err := storage.RemoveAllButCurrent(artifact); err != nil {
+		t.Fatalf("RemoveAllButCurrent() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "repo", "a.tar.gz")); !os.IsNotExist(err) {
+		t.Error("RemoveAllButCurrent() kept a.tar.gz")
+	}
+	if !storage.ArtifactExist(artifact) {
+		t.Error("RemoveAllButCurrent() removed the current artifact")
+	}
+
+	missing := sourcev1.Artifact{Path: filepath.Join(tmp, "missing", "a.tar.gz")}
+	if err := storage.RemoveAllButCurrent(missing); err != nil {
+		t.Errorf("RemoveAllButCurrent() error = %v for missing dir", err)
+	}
+}
+
+func TestStorage_RemoveAllButNames(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "removeallbutnames")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	storage, err := NewStorage(tmp, "localhost", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createFiles(t, filepath.Join(tmp, "branches"), map[string]string{
+		"main/a.tar.gz":           "main",
+		"preview--foo/b.tar.gz":   "foo",
+		"preview--bar/c.tar.gz":   "bar",
+		"preview--bar/latest.tgz": "bar",
+	})
+	artifact := sourcev1.Artifact{Path: filepath.Join(tmp, "branches", "*")}
+	keep := map[string]bool{"main": true, "preview--foo": true}
+	if err := storage.RemoveAllButNames(artifact, keep); err != nil {
+		t.Fatalf("RemoveAllButNames() error = %v", err)
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(tmp, "branches"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	if strings.Join(got, ",") != "main,preview--foo" {
+		t.Errorf("RemoveAllButNames() kept %v", got)
+	}
+
+	missing := sourcev1.Artifact{Path: filepath.Join(tmp, "missing", "*")}
+	if err := storage.RemoveAllButNames(missing, keep); err != nil {
+		t.Errorf("RemoveAllButNames() error = %v for missing dir", err)
+	}
+}
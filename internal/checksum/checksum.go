@@ -0,0 +1,56 @@
+package checksum
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// SHA256 returns the hex encoded SHA256 checksum of the given bytes.
+func SHA256(b []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(b))
+}
+
+// Verify checks the SHA256 checksum of the given bytes against the
+// expected hex encoded checksum.
+func Verify(b []byte, expected string) error {
+	return VerifySum(SHA256(b), expected)
+}
+
+// VerifySum checks the hex encoded SHA256 checksum against the expected
+// one, for data that was hashed while streamed.
+func VerifySum(sum, expected string) error {
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if _, err := hex.DecodeString(expected); err != nil || len(expected) != sha256.Size*2 {
+		return fmt.Errorf("invalid SHA256 checksum '%s'", expected)
+	}
+	if sum != expected {
+		return fmt.Errorf("checksum mismatch, expected '%s' got '%s'", expected, sum)
+	}
+	return nil
+}
+
+// FromChecksumsFile returns the checksum for the given file name from
+// a checksums file in the format produced by sha256sum, e.g.
+// '<checksum>  <file name>', one file per line.
+func FromChecksumsFile(data []byte, fileName string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// sha256sum marks files read in binary mode with '*'
+		name := strings.TrimPrefix(fields[1], "*")
+		if name == fileName || strings.TrimPrefix(name, "./") == fileName {
+			return fields[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum found for '%s'", fileName)
+}
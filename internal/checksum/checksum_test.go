@@ -0,0 +1,60 @@
+package checksum
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	data := []byte("podinfo")
+	sum := SHA256(data)
+	tests := []struct {
+		name     string
+		expected string
+		wantErr  bool
+	}{
+		{"match", sum, false},
+		{"upper case", "  " + strings.ToUpper(sum) + "\n", false},
+		{"mismatch", SHA256([]byte("other")), true},
+		{"invalid", "not-a-checksum", true},
+		{"truncated", sum[:40], true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(data, tt.expected); (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFromChecksumsFile(t *testing.T) {
+	checksums := []byte(`e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  podinfo-linux-amd64.tar.gz
+9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08 *podinfo-darwin-amd64.tar.gz
+60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752  ./manifests.zip
+invalid line
+`)
+	tests := []struct {
+		name     string
+		fileName string
+		want     string
+		wantErr  bool
+	}{
+		{"text mode", "podinfo-linux-amd64.tar.gz", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", false},
+		{"binary mode", "podinfo-darwin-amd64.tar.gz", "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", false},
+		{"relative path", "manifests.zip", "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752", false},
+		{"missing", "podinfo-windows-amd64.zip", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromChecksumsFile(checksums, tt.fileName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FromChecksumsFile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("FromChecksumsFile() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package git
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+
+	"github.com/fluxcd/source-controller/internal/lockedfile"
+)
+
+// Cache is an on-disk cache of bare repositories keyed by namespace and
+// URL. Repositories of a namespace sharing a URL share the object store,
+// regardless of the references they fetch. The namespaces never share
+// objects, the objects fetched with the credentials of a namespace are
+// not served to the others.
+type Cache struct {
+	// Path is the directory the repositories are stored in.
+	Path string
+
+	// MaxSize is the size in bytes above which the least recently used
+	// repositories are evicted.
+	MaxSize int64
+}
+
+// NewCache returns a cache stored in path, creating the directory if
+// it does not exist.
+func NewCache(path string, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	return &Cache{Path: path, MaxSize: maxSize}, nil
+}
+
+// Fetch updates the cached repository of the namespace and URL with the
+// refspecs, initialising it on first use, and returns it with its
+// worktree at dir. The cached repository is locked until unlock is called.
+func (c *Cache) Fetch(namespace, url string, auth transport.AuthMethod, refSpecs []config.RefSpec, dir string) (repo *git.Repository, unlock func(), err error) {
+	path := c.repositoryPath(namespace, url)
+	unlock, err = lock(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to acquire lock: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			unlock()
+		}
+	}()
+
+	storer := filesystem.NewStorage(osfs.New(path), cache.NewObjectLRUDefault())
+	repo, err = git.Open(storer, osfs.New(dir))
+	if err == git.ErrRepositoryNotExists {
+		repo, err = c.init(storer, url, dir)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = Fetch(repo, url, auth, refSpecs, 0); err != nil {
+		return nil, nil, err
+	}
+
+	// record the use for the LRU eviction
+	now := time.Now()
+	if err = os.Chtimes(path, now, now); err != nil {
+		return nil, nil, err
+	}
+	return repo, unlock, nil
+}
+
+// GC evicts the least recently used repositories until the cache size
+// is below MaxSize.
+func (c *Cache) GC() error {
+	entries, err := ioutil.ReadDir(c.Path)
+	if err != nil {
+		return err
+	}
+
+	var dirs []os.FileInfo
+	sizes := make(map[string]int64)
+	var total int64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		size, err := dirSize(filepath.Join(c.Path, entry.Name()))
+		if err != nil {
+			return err
+		}
+		dirs = append(dirs, entry)
+		sizes[entry.Name()] = size
+		total += size
+	}
+
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].ModTime().Before(dirs[j].ModTime())
+	})
+
+	var errors []string
+	for _, dir := range dirs {
+		if total <= c.MaxSize {
+			break
+		}
+		path := filepath.Join(c.Path, dir.Name())
+		if err := removeLocked(path); err != nil {
+			errors = append(errors, err.Error())
+			continue
+		}
+		total -= sizes[dir.Name()]
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("failed to evict cached repositories: %s", strings.Join(errors, " "))
+	}
+	return nil
+}
+
+// repositoryPath returns the path of the cached repository, namespaces
+// cannot contain slashes, so the key is unambiguous.
+func (c *Cache) repositoryPath(namespace, url string) string {
+	key := fmt.Sprintf("%s/%s", namespace, url)
+	return filepath.Join(c.Path, fmt.Sprintf("%x", sha256.Sum256([]byte(key))))
+}
+
+// init creates a bare repository with the URL as origin and opens it
+// with its worktree at dir.
+func (c *Cache) init(storer *filesystem.Storage, url, dir string) (*git.Repository, error) {
+	repo, err := git.Init(storer, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{url},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return git.Open(storer, osfs.New(dir))
+}
+
+// lock locks the cached repository at path. The lock file is removed
+// with the repository on eviction, a lock acquired on a removed file is
+// retried on the current one.
+func lock(path string) (func(), error) {
+	name := path + ".lock"
+	for {
+		f, err := lockedfile.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			return nil, err
+		}
+		locked, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		current, err := os.Stat(name)
+		if err == nil && os.SameFile(locked, current) {
+			return func() { f.Close() }, nil
+		}
+		f.Close()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
+
+func removeLocked(path string) error {
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+	return os.Remove(path + ".lock")
+}
+
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,140 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestCache_Fetch(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "cache-fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	origin := filepath.Join(tmp, "origin")
+	remote, err := git.PlainInit(origin, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitFile := func(content string) plumbing.Hash {
+		if err := ioutil.WriteFile(filepath.Join(origin, "file"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		w, err := remote.Worktree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Add("file"); err != nil {
+			t.Fatal(err)
+		}
+		hash, err := w.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	c, err := NewCache(filepath.Join(tmp, "cache"), 1<<30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refSpecs := []config.RefSpec{"+refs/heads/master:refs/heads/master"}
+
+	for i, content := range []string{"v1", "v2"} {
+		want := commitFile(content)
+		dir := filepath.Join(tmp, content)
+		repo, unlock, err := c.Fetch("default", origin, nil, refSpecs, dir)
+		if err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+
+		hash, err := repo.ResolveRevision(plumbing.Revision("refs/heads/master"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *hash != want {
+			t.Errorf("Fetch() got revision %s, want %s", hash, want)
+		}
+		w, err := repo.Worktree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+			t.Fatal(err)
+		}
+		unlock()
+
+		got, err := ioutil.ReadFile(filepath.Join(dir, "file"))
+		if err != nil {
+			t.Fatalf("checkout %d: %v", i, err)
+		}
+		if string(got) != content {
+			t.Errorf("checkout %d got = %s, want %s", i, got, content)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(c.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var repos int
+	for _, entry := range entries {
+		if entry.IsDir() {
+			repos++
+		}
+	}
+	if repos != 1 {
+		t.Errorf("cache got %d repositories, want 1", repos)
+	}
+}
+
+func TestCache_GC(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "cache-gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	c := &Cache{Path: tmp, MaxSize: 10}
+	now := time.Now()
+	for i, name := range []string{"old", "new"} {
+		dir := filepath.Join(tmp, name)
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "objects"), []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(dir, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(dir+".lock", nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.GC(); err != nil {
+		t.Fatalf("GC() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "old")); !os.IsNotExist(err) {
+		t.Error("GC() expected least recently used repository to be evicted")
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "old.lock")); !os.IsNotExist(err) {
+		t.Error("GC() expected lock file of the evicted repository to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "new")); err != nil {
+		t.Errorf("GC() expected most recently used repository to be kept: %v", err)
+	}
+}
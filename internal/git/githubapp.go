@@ -0,0 +1,299 @@
+package git
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	nethttp "net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// GitHubAPIURL is the default GitHub API URL of GitHub Apps.
+	GitHubAPIURL = "https://api.github.com"
+
+	githubAppIDKey             = "githubAppID"
+	githubAppInstallationIDKey = "githubAppInstallationID"
+	githubAppPrivateKeyKey     = "githubAppPrivateKey"
+	githubAppBaseURLKey        = "githubAppBaseURL"
+
+	// githubAppTokenMargin is the time before their expiry the
+	// installation tokens are renewed at.
+	githubAppTokenMargin = 5 * time.Minute
+
+	// githubAppTokenTTL is the lifetime of the installation tokens
+	// returned with no expiry, the lifetime of the GitHub tokens.
+	githubAppTokenTTL = time.Hour
+
+	// githubAppTimeout is the timeout of the requests of the default
+	// client to the GitHub API.
+	githubAppTimeout = 30 * time.Second
+)
+
+// GitHubApp holds the credentials of a GitHub App installation.
+type GitHubApp struct {
+	// BaseURL is the URL of the GitHub API.
+	BaseURL string
+
+	// AppID is the ID of the GitHub App.
+	AppID int64
+
+	// InstallationID is the ID of the installation of the GitHub App in
+	// the organization or account owning the repositories.
+	InstallationID int64
+
+	// PrivateKey is the private key of the GitHub App.
+	PrivateKey *rsa.PrivateKey
+
+	// keyDigest is the digest of the PEM private key.
+	keyDigest string
+}
+
+// GitHubAppFromSecret returns the GitHub App of the 'githubAppID',
+// 'githubAppInstallationID' and 'githubAppPrivateKey' of the secret, with
+// the API at the optional 'githubAppBaseURL'. It returns nil if the secret
+// has none of them.
+func GitHubAppFromSecret(secret corev1.Secret) (*GitHubApp, error) {
+	appID := strings.TrimSpace(string(secret.Data[githubAppIDKey]))
+	installationID := strings.TrimSpace(string(secret.Data[githubAppInstallationIDKey]))
+	privateKey := secret.Data[githubAppPrivateKeyKey]
+	switch {
+	case appID == "" && installationID == "" && len(privateKey) == 0:
+		return nil, nil
+	case appID == "" || installationID == "" || len(privateKey) == 0:
+		return nil, fmt.Errorf("invalid '%s' secret data: required fields '%s', '%s' and '%s'",
+			secret.Name, githubAppIDKey, githubAppInstallationIDKey, githubAppPrivateKeyKey)
+	}
+
+	app := &GitHubApp{BaseURL: GitHubAPIURL}
+	if baseURL := strings.TrimSpace(string(secret.Data[githubAppBaseURLKey])); baseURL != "" {
+		app.BaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+	var err error
+	if app.AppID, err = strconv.ParseInt(appID, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid '%s' secret data: '%s' is not a number", secret.Name, githubAppIDKey)
+	}
+	if app.InstallationID, err = strconv.ParseInt(installationID, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid '%s' secret data: '%s' is not a number", secret.Name, githubAppInstallationIDKey)
+	}
+	if app.PrivateKey, err = parseRSAPrivateKey(privateKey); err != nil {
+		return nil, fmt.Errorf("invalid '%s' secret data: '%s' error: %w", secret.Name, githubAppPrivateKeyKey, err)
+	}
+	app.keyDigest = fmt.Sprintf("%x", sha256.Sum256(privateKey))
+	return app, nil
+}
+
+// parseRSAPrivateKey parses the PKCS #1 or PKCS #8 PEM RSA private key.
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// jwt returns the JSON Web Token the GitHub App authenticates with to the
+// GitHub API, valid for 10 minutes at most.
+func (app *GitHubApp) jwt(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(struct {
+		IssuedAt  int64 `json:"iat"`
+		ExpiresAt int64 `json:"exp"`
+		Issuer    int64 `json:"iss"`
+	}{
+		// allow for clock drift
+		IssuedAt:  now.Add(-time.Minute).Unix(),
+		ExpiresAt: now.Add(9 * time.Minute).Unix(),
+		Issuer:    app.AppID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	h := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, app.PrivateKey, crypto.SHA256, h[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// GitHubAppProvider mints the installation tokens of GitHub Apps, and
+// caches them until shortly before their expiry.
+type GitHubAppProvider struct {
+	// Client sends the requests to the GitHub API, a client with a 30
+	// seconds timeout is used when nil.
+	Client *nethttp.Client
+
+	mu     sync.Mutex
+	tokens map[string]*githubAppTokenEntry
+}
+
+// githubAppTokenEntry is the cached token of an installation. Its lock
+// is held while minting the token, the installations don't wait for
+// each other.
+type githubAppTokenEntry struct {
+	mu    sync.Mutex
+	token githubAppToken
+
+	// expiresAt is the expiry of the token, guarded by the provider
+	// lock for the eviction of the expired entries.
+	expiresAt time.Time
+}
+
+// githubAppToken is an installation token of a GitHub App.
+type githubAppToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// defaultGitHubAppClient is the client of the providers without one.
+var defaultGitHubAppClient = &nethttp.Client{Timeout: githubAppTimeout}
+
+// DefaultGitHubAppProvider is the provider of the GitHub App auth methods
+// returned for secrets.
+var DefaultGitHubAppProvider = &GitHubAppProvider{}
+
+// AuthMethod returns the basic auth of the installation token of the
+// GitHub App, which GitHub accepts for HTTPS clones.
+func (p *GitHubAppProvider) AuthMethod(app *GitHubApp) (*http.BasicAuth, error) {
+	token, err := p.Token(app)
+	if err != nil {
+		return nil, err
+	}
+	return &http.BasicAuth{Username: "x-access-token", Password: token}, nil
+}
+
+// Token returns the cached installation token of the GitHub App, or a new
+// one when it expires in less than 5 minutes.
+func (p *GitHubAppProvider) Token(app *GitHubApp) (string, error) {
+	entry := p.entry(githubAppKey(app))
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	now := time.Now()
+	if now.Add(githubAppTokenMargin).Before(entry.token.ExpiresAt) {
+		return entry.token.Token, nil
+	}
+
+	token, err := p.mint(app, now)
+	if err != nil {
+		// the failed entry is evicted with the expired ones
+		p.mu.Lock()
+		entry.expiresAt = now
+		p.mu.Unlock()
+		return "", fmt.Errorf("GitHub App '%d' installation '%d' token error: %w", app.AppID, app.InstallationID, err)
+	}
+	entry.token = token
+
+	p.mu.Lock()
+	entry.expiresAt = token.ExpiresAt
+	p.mu.Unlock()
+	return token.Token, nil
+}
+
+// githubAppKey returns the cache key of the installation tokens of the
+// GitHub App. The tokens are bound to the private key, secrets holding
+// the same IDs with another key don't share them.
+func githubAppKey(app *GitHubApp) string {
+	return fmt.Sprintf("%s/%d/%d/%s", app.BaseURL, app.AppID, app.InstallationID, app.keyDigest)
+}
+
+// entry returns the cache entry of the key, evicting the expired ones.
+// The new entries have no expiry until their token is minted.
+func (p *GitHubAppProvider) entry(key string) *githubAppTokenEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if entry, ok := p.tokens[key]; ok {
+		return entry
+	}
+
+	if p.tokens == nil {
+		p.tokens = make(map[string]*githubAppTokenEntry)
+	}
+	now := time.Now()
+	for k, e := range p.tokens {
+		if !e.expiresAt.IsZero() && now.After(e.expiresAt) {
+			delete(p.tokens, k)
+		}
+	}
+	entry := &githubAppTokenEntry{}
+	p.tokens[key] = entry
+	return entry
+}
+
+// mint requests a new installation token from the GitHub API.
+func (p *GitHubAppProvider) mint(app *GitHubApp, now time.Time) (githubAppToken, error) {
+	jwt, err := app.jwt(now)
+	if err != nil {
+		return githubAppToken{}, err
+	}
+
+	url := fmt.Sprintf("%s/app/installations/%d/access_tokens", app.BaseURL, app.InstallationID)
+	req, err := nethttp.NewRequest(nethttp.MethodPost, url, nil)
+	if err != nil {
+		return githubAppToken{}, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	client := p.Client
+	if client == nil {
+		client = defaultGitHubAppClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return githubAppToken{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return githubAppToken{}, err
+	}
+	if resp.StatusCode != nethttp.StatusCreated {
+		var message struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(body, &message); err != nil || message.Message == "" {
+			return githubAppToken{}, fmt.Errorf("'%s' returned %s", url, resp.Status)
+		}
+		return githubAppToken{}, fmt.Errorf("'%s' returned %s: %s", url, resp.Status, message.Message)
+	}
+
+	var token githubAppToken
+	if err := json.Unmarshal(body, &token); err != nil {
+		return githubAppToken{}, fmt.Errorf("invalid token response: %w", err)
+	}
+	if token.Token == "" {
+		return githubAppToken{}, fmt.Errorf("token response has no token")
+	}
+	if token.ExpiresAt.IsZero() {
+		token.ExpiresAt = now.Add(githubAppTokenTTL)
+	}
+	return token, nil
+}
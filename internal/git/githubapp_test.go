@@ -0,0 +1,323 @@
+package git
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testGitHubAppKey returns a new RSA key and its PKCS #1 PEM encoding.
+func testGitHubAppKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// testGitHubAPI is a fake GitHub API minting the installation tokens of
+// the app 1234 installation 42, which expire after expiresIn, or have no
+// expiry if it is zero. The caller closes it.
+type testGitHubAPI struct {
+	*httptest.Server
+	key       *rsa.PublicKey
+	expiresIn time.Duration
+	requests  int
+}
+
+func newTestGitHubAPI(t *testing.T, key *rsa.PublicKey) *testGitHubAPI {
+	api := &testGitHubAPI{key: key, expiresIn: time.Hour}
+	api.Server = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		if r.Method != nethttp.MethodPost || r.URL.Path != "/app/installations/42/access_tokens" {
+			w.WriteHeader(nethttp.StatusNotFound)
+			return
+		}
+		if err := api.verifyJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); err != nil {
+			w.WriteHeader(nethttp.StatusUnauthorized)
+			fmt.Fprintf(w, `{"message":%q}`, err.Error())
+			return
+		}
+		api.requests++
+		token := githubAppToken{Token: fmt.Sprintf("token-%d", api.requests)}
+		if api.expiresIn != 0 {
+			token.ExpiresAt = time.Now().Add(api.expiresIn)
+		}
+		w.WriteHeader(nethttp.StatusCreated)
+		json.NewEncoder(w).Encode(token)
+	}))
+	return api
+}
+
+// verifyJWT verifies the JWT was signed by the app key and issued by the
+// app.
+func (api *testGitHubAPI) verifyJWT(jwt string) error {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid JWT")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return err
+	}
+	h := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(api.key, crypto.SHA256, h[:], signature); err != nil {
+		return fmt.Errorf("invalid JWT signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		ExpiresAt int64 `json:"exp"`
+		Issuer    int64 `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return err
+	}
+	if claims.Issuer != 1234 || time.Unix(claims.ExpiresAt, 0).Before(time.Now()) {
+		return fmt.Errorf("invalid JWT claims")
+	}
+	return nil
+}
+
+func TestGitHubAppFromSecret(t *testing.T) {
+	key, keyPEM := testGitHubAppKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8PEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+
+	tests := []struct {
+		name        string
+		data        map[string][]byte
+		wantNil     bool
+		wantBaseURL string
+		wantErr     bool
+	}{
+		{"no GitHub App", map[string][]byte{"username": []byte("git")}, true, "", false},
+		{"GitHub App", map[string][]byte{
+			"githubAppID": []byte("1234"), "githubAppInstallationID": []byte("42\n"), "githubAppPrivateKey": keyPEM,
+		}, false, GitHubAPIURL, false},
+		{"PKCS #8 key and base URL", map[string][]byte{
+			"githubAppID": []byte("1234"), "githubAppInstallationID": []byte("42"), "githubAppPrivateKey": pkcs8PEM,
+			"githubAppBaseURL": []byte("https://github.example.com/api/v3/"),
+		}, false, "https://github.example.com/api/v3", false},
+		{"missing installation ID", map[string][]byte{
+			"githubAppID": []byte("1234"), "githubAppPrivateKey": keyPEM,
+		}, false, "", true},
+		{"invalid app ID", map[string][]byte{
+			"githubAppID": []byte("app"), "githubAppInstallationID": []byte("42"), "githubAppPrivateKey": keyPEM,
+		}, false, "", true},
+		{"invalid installation ID", map[string][]byte{
+			"githubAppID": []byte("1234"), "githubAppInstallationID": []byte("42/../1"), "githubAppPrivateKey": keyPEM,
+		}, false, "", true},
+		{"invalid private key", map[string][]byte{
+			"githubAppID": []byte("1234"), "githubAppInstallationID": []byte("42"), "githubAppPrivateKey": []byte("invalid"),
+		}, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "github-app"}, Data: tt.data}
+			got, err := GitHubAppFromSecret(secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GitHubAppFromSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("GitHubAppFromSecret() got = %v, wantNil %v", got, tt.wantNil)
+			}
+			if got == nil {
+				return
+			}
+			if got.AppID != 1234 || got.InstallationID != 42 {
+				t.Errorf("GitHubAppFromSecret() IDs = %d/%d, want 1234/42", got.AppID, got.InstallationID)
+			}
+			if got.BaseURL != tt.wantBaseURL {
+				t.Errorf("GitHubAppFromSecret() base URL = %v, want %v", got.BaseURL, tt.wantBaseURL)
+			}
+		})
+	}
+}
+
+func TestGitHubAppProvider_Token(t *testing.T) {
+	key, keyPEM := testGitHubAppKey(t)
+	_, otherKeyPEM := testGitHubAppKey(t)
+	api := newTestGitHubAPI(t, &key.PublicKey)
+	defer api.Close()
+
+	app := func(keyPEM []byte) *GitHubApp {
+		app, err := GitHubAppFromSecret(corev1.Secret{Data: map[string][]byte{
+			"githubAppID":             []byte("1234"),
+			"githubAppInstallationID": []byte("42"),
+			"githubAppPrivateKey":     keyPEM,
+			"githubAppBaseURL":        []byte(api.URL),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return app
+	}
+	p := &GitHubAppProvider{}
+
+	token, err := p.Token(app(keyPEM))
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if token != "token-1" {
+		t.Errorf("Token() = %v, want token-1", token)
+	}
+
+	// cached until shortly before expiry
+	if token, err = p.Token(app(keyPEM)); err != nil || token != "token-1" {
+		t.Errorf("Token() = %v, %v, want cached token-1", token, err)
+	}
+
+	// renewed shortly before expiry
+	api.expiresIn = time.Minute
+	p = &GitHubAppProvider{}
+	for _, want := range []string{"token-2", "token-3"} {
+		if token, err = p.Token(app(keyPEM)); err != nil || token != want {
+			t.Errorf("Token() = %v, %v, want %v", token, err, want)
+		}
+	}
+
+	// not shared with another key, which is rejected
+	if token, err = p.Token(app(otherKeyPEM)); err == nil {
+		t.Errorf("Token() = %v, want error for the wrong key", token)
+	}
+	if api.requests != 3 {
+		t.Errorf("Token() minted %d tokens, want 3", api.requests)
+	}
+}
+
+func TestGitHubAppProvider_TokenExpiry(t *testing.T) {
+	key, keyPEM := testGitHubAppKey(t)
+	_, otherKeyPEM := testGitHubAppKey(t)
+	api := newTestGitHubAPI(t, &key.PublicKey)
+	defer api.Close()
+	api.expiresIn = 0
+
+	app := func(keyPEM []byte) *GitHubApp {
+		app, err := GitHubAppFromSecret(corev1.Secret{Data: map[string][]byte{
+			"githubAppID":             []byte("1234"),
+			"githubAppInstallationID": []byte("42"),
+			"githubAppPrivateKey":     keyPEM,
+			"githubAppBaseURL":        []byte(api.URL),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return app
+	}
+	p := &GitHubAppProvider{}
+
+	// the tokens with no expiry are cached for the default lifetime
+	for i := 0; i < 2; i++ {
+		if token, err := p.Token(app(keyPEM)); err != nil || token != "token-1" {
+			t.Errorf("Token() = %v, %v, want token-1", token, err)
+		}
+	}
+	if entry := p.tokens[githubAppKey(app(keyPEM))]; entry == nil || entry.expiresAt.IsZero() {
+		t.Errorf("Token() cached %+v, want an expiry", entry)
+	}
+
+	// the entry of a failed token is evicted
+	if _, err := p.Token(app(otherKeyPEM)); err == nil {
+		t.Error("Token() error = nil for the wrong key")
+	}
+	p.entry("other")
+	if _, ok := p.tokens[githubAppKey(app(otherKeyPEM))]; ok {
+		t.Error("Token() kept the entry of the failed token")
+	}
+}
+
+func TestGitHubAppProvider_TokenConcurrent(t *testing.T) {
+	key, keyPEM := testGitHubAppKey(t)
+	api := newTestGitHubAPI(t, &key.PublicKey)
+	defer api.Close()
+
+	// the API of the other installation hangs until released
+	received, release := make(chan struct{}), make(chan struct{})
+	hanging := httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		close(received)
+		<-release
+		w.WriteHeader(nethttp.StatusServiceUnavailable)
+	}))
+	defer hanging.Close()
+	defer close(release)
+
+	app := func(baseURL string) *GitHubApp {
+		app, err := GitHubAppFromSecret(corev1.Secret{Data: map[string][]byte{
+			"githubAppID":             []byte("1234"),
+			"githubAppInstallationID": []byte("42"),
+			"githubAppPrivateKey":     keyPEM,
+			"githubAppBaseURL":        []byte(baseURL),
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return app
+	}
+	p := &GitHubAppProvider{}
+
+	go p.Token(app(hanging.URL))
+	<-received
+
+	done := make(chan error)
+	go func() {
+		_, err := p.Token(app(api.URL))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Token() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Token() waited for the token of another installation")
+	}
+}
+
+func TestHTTPAuthFromSecret_GitHubApp(t *testing.T) {
+	key, keyPEM := testGitHubAppKey(t)
+	api := newTestGitHubAPI(t, &key.PublicKey)
+	defer api.Close()
+	data := map[string][]byte{
+		"githubAppID":             []byte("1234"),
+		"githubAppInstallationID": []byte("42"),
+		"githubAppPrivateKey":     keyPEM,
+		"githubAppBaseURL":        []byte(api.URL),
+	}
+
+	auth, _, err := AuthMethodFromSecret("https://github.com/org/repo.git", corev1.Secret{Data: data})
+	if err != nil {
+		t.Fatalf("AuthMethodFromSecret() error = %v", err)
+	}
+	basicAuth, ok := auth.(*http.BasicAuth)
+	if !ok || basicAuth.Username != "x-access-token" || !strings.HasPrefix(basicAuth.Password, "token-") {
+		t.Errorf("AuthMethodFromSecret() got = %v, want installation token basic auth", auth)
+	}
+
+	data["bearerToken"] = []byte("token")
+	if _, _, err := AuthMethodFromSecret("https://github.com/org/repo.git", corev1.Secret{Data: data}); err == nil {
+		t.Error("AuthMethodFromSecret() expected error for GitHub App and bearer token")
+	}
+}
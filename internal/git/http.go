@@ -0,0 +1,95 @@
+package git
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	nethttp "net/http"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// HTTPAuth is the auth method of HTTP repositories served with a custom
+// TLS config, e.g. by a private CA or requiring client certificates. Its
+// requests are sent with a client of its own.
+type HTTPAuth struct {
+	// AuthMethod sets the credentials of the requests, if not nil.
+	AuthMethod http.AuthMethod
+
+	client *nethttp.Client
+}
+
+// NewHTTPAuth returns the HTTP auth method sending the requests with the
+// TLS config, and the credentials of the auth method if not nil.
+func NewHTTPAuth(auth http.AuthMethod, config *tls.Config) *HTTPAuth {
+	t := nethttp.DefaultTransport.(*nethttp.Transport).Clone()
+	t.TLSClientConfig = config
+	return &HTTPAuth{AuthMethod: auth, client: &nethttp.Client{Transport: t}}
+}
+
+// SetAuth sets the credentials of the request.
+func (a *HTTPAuth) SetAuth(r *nethttp.Request) {
+	if a.AuthMethod != nil {
+		a.AuthMethod.SetAuth(r)
+	}
+}
+
+// Name is the name of the auth method.
+func (a *HTTPAuth) Name() string {
+	return "http-tls-auth"
+}
+
+func (a *HTTPAuth) String() string {
+	if a.AuthMethod == nil {
+		return a.Name()
+	}
+	return fmt.Sprintf("%s - %s", a.Name(), a.AuthMethod)
+}
+
+// CloseIdleConnections closes the idle connections of the client.
+func (a *HTTPAuth) CloseIdleConnections() {
+	a.client.CloseIdleConnections()
+}
+
+// TLSConfigFromSecret returns the TLS config trusting the 'caFile' CA
+// certificates, and presenting the 'certFile' and 'keyFile' client
+// certificate, of the secret. It returns nil if none of them is set.
+func TLSConfigFromSecret(secret corev1.Secret) (*tls.Config, error) {
+	certBytes, keyBytes, caBytes := secret.Data["certFile"], secret.Data["keyFile"], secret.Data["caFile"]
+	switch {
+	case len(certBytes)+len(keyBytes)+len(caBytes) == 0:
+		return nil, nil
+	case len(certBytes) == 0 && len(keyBytes) > 0 || len(certBytes) > 0 && len(keyBytes) == 0:
+		return nil, fmt.Errorf("invalid '%s' secret data: required fields 'certFile' and 'keyFile'", secret.Name)
+	}
+
+	config := &tls.Config{}
+	if len(certBytes) > 0 {
+		cert, err := tls.X509KeyPair(certBytes, keyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid '%s' secret client certificate: %w", secret.Name, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(caBytes) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("invalid '%s' secret data: no certificate found in 'caFile'", secret.Name)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// newTransport returns the transport of the endpoint for the auth method,
+// HTTPAuth auth methods send the requests of HTTP endpoints with their
+// own client. The others use the go-git transports.
+func newTransport(ep *transport.Endpoint, auth transport.AuthMethod) (transport.Transport, error) {
+	if a, ok := auth.(*HTTPAuth); ok && (ep.Protocol == "http" || ep.Protocol == "https") {
+		return http.NewClient(a.client), nil
+	}
+	return client.NewClient(ep)
+}
@@ -0,0 +1,242 @@
+package git
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	nethttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testCert returns the PEM certificate and key of a new certificate,
+// signed by the parent if not nil, self-signed otherwise.
+func testCert(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// testTLSFixtures returns the PEM CA certificate, and the server and
+// client certificates and keys it signed.
+func testTLSFixtures(t *testing.T) (caPEM []byte, serverCert tls.Certificate, clientCert, clientKey []byte) {
+	ca, caKey, caPEM, _ := testCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	_, _, serverPEM, serverKey := testCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "git.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	_, _, clientCert, clientKey = testCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "source-controller"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	serverCert, err := tls.X509KeyPair(serverPEM, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return caPEM, serverCert, clientCert, clientKey
+}
+
+func TestTLSConfigFromSecret(t *testing.T) {
+	caPEM, _, clientCert, clientKey := testTLSFixtures(t)
+
+	tests := []struct {
+		name      string
+		data      map[string][]byte
+		wantNil   bool
+		wantCerts int
+		wantCA    bool
+		wantErr   bool
+	}{
+		{"no TLS", map[string][]byte{"username": []byte("git")}, true, 0, false, false},
+		{"CA", map[string][]byte{"caFile": caPEM}, false, 0, true, false},
+		{"client certificate", map[string][]byte{"certFile": clientCert, "keyFile": clientKey}, false, 1, false, false},
+		{"CA and client certificate", map[string][]byte{"caFile": caPEM, "certFile": clientCert, "keyFile": clientKey}, false, 1, true, false},
+		{"missing key", map[string][]byte{"caFile": caPEM, "certFile": clientCert}, false, 0, false, true},
+		{"missing certificate", map[string][]byte{"keyFile": clientKey}, false, 0, false, true},
+		{"invalid CA", map[string][]byte{"caFile": []byte("invalid")}, false, 0, false, true},
+		{"invalid client certificate", map[string][]byte{"certFile": clientCert, "keyFile": []byte("invalid")}, false, 0, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "tls"}, Data: tt.data}
+			got, err := TLSConfigFromSecret(secret)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TLSConfigFromSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Fatalf("TLSConfigFromSecret() got = %v, wantNil %v", got, tt.wantNil)
+			}
+			if got == nil {
+				return
+			}
+			if len(got.Certificates) != tt.wantCerts {
+				t.Errorf("TLSConfigFromSecret() got %d certificates, want %d", len(got.Certificates), tt.wantCerts)
+			}
+			if (got.RootCAs != nil) != tt.wantCA {
+				t.Errorf("TLSConfigFromSecret() RootCAs = %v, wantCA %v", got.RootCAs, tt.wantCA)
+			}
+		})
+	}
+}
+
+func TestHTTPAuthFromSecret(t *testing.T) {
+	caPEM, serverCert, clientCert, clientKey := testTLSFixtures(t)
+
+	var authorization string
+	server := httptest.NewUnstartedServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(nethttp.StatusUnauthorized)
+	}))
+	caPool := x509.NewCertPool()
+	caPool.AppendCertsFromPEM(caPEM)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	url := server.URL + "/org/repo.git"
+
+	tests := []struct {
+		name        string
+		data        map[string][]byte
+		wantAuth    transport.AuthMethod
+		wantReached bool
+		wantHeader  bool
+	}{
+		{"basic auth", map[string][]byte{"username": []byte("git"), "password": []byte("password")}, &http.BasicAuth{}, false, false},
+		{"CA without client certificate", map[string][]byte{"caFile": caPEM}, &HTTPAuth{}, false, false},
+		{"mutual TLS", map[string][]byte{"caFile": caPEM, "certFile": clientCert, "keyFile": clientKey}, &HTTPAuth{}, true, false},
+		{"mutual TLS and basic auth", map[string][]byte{
+			"caFile": caPEM, "certFile": clientCert, "keyFile": clientKey,
+			"username": []byte("git"), "password": []byte("password"),
+		}, &HTTPAuth{}, true, true},
+		{"mutual TLS and bearer token", map[string][]byte{
+			"caFile": caPEM, "certFile": clientCert, "keyFile": clientKey,
+			"bearerToken": []byte("token"),
+		}, &HTTPAuth{}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authorization = ""
+			secret := corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "tls"}, Data: tt.data}
+			auth, cleanup, err := AuthMethodFromSecret(url, secret)
+			if err != nil {
+				t.Fatalf("AuthMethodFromSecret() error = %v", err)
+			}
+			if cleanup != nil {
+				defer cleanup()
+			}
+			if reflect.TypeOf(auth) != reflect.TypeOf(tt.wantAuth) {
+				t.Fatalf("AuthMethodFromSecret() got = %T, want %T", auth, tt.wantAuth)
+			}
+
+			_, err = RemoteReferences(url, auth)
+			if err == nil {
+				t.Fatal("RemoteReferences() expected error")
+			}
+			if reached := IsAuthError(auth, err); reached != tt.wantReached {
+				t.Errorf("RemoteReferences() reached server = %v, want %v, error: %v", reached, tt.wantReached, err)
+			}
+			if header := authorization != ""; header != tt.wantHeader {
+				t.Errorf("RemoteReferences() Authorization header = %v, want %v", header, tt.wantHeader)
+			}
+
+			repo, err := git.Init(memory.NewStorage(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = Fetch(repo, url, auth, []config.RefSpec{"+refs/heads/*:refs/heads/*"}, 0)
+			if err == nil {
+				t.Fatal("Fetch() expected error")
+			}
+			if reached := IsAuthError(auth, err); reached != tt.wantReached {
+				t.Errorf("Fetch() reached server = %v, want %v, error: %v", reached, tt.wantReached, err)
+			}
+		})
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	// the package leaves the go-git transports untouched
+	for _, scheme := range []string{"http", "https"} {
+		if client.Protocols[scheme] != http.DefaultClient {
+			t.Errorf("go-git %s transport = %T, want the default client", scheme, client.Protocols[scheme])
+		}
+	}
+
+	ep, err := transport.NewEndpoint("https://git.example.com/org/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewHTTPAuth(nil, &tls.Config{})
+	got, err := newTransport(ep, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == http.DefaultClient {
+		t.Error("newTransport() = default client, want the client of the auth method")
+	}
+	got, err = newTransport(ep, &http.BasicAuth{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != http.DefaultClient {
+		t.Errorf("newTransport() = %T, want the default client", got)
+	}
+}
@@ -0,0 +1,277 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/format/packfile"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/capability"
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp/sideband"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// RemoteReference is a reference advertised by a remote repository.
+type RemoteReference struct {
+	// Hash is the object the reference points to.
+	Hash plumbing.Hash
+
+	// Commit is the commit the reference resolves to, for annotated
+	// tags this is the peeled tag object.
+	Commit plumbing.Hash
+}
+
+// RemoteReferences lists the references of the remote repository
+// without fetching any objects, like 'git ls-remote' does.
+func RemoteReferences(url string, auth transport.AuthMethod) (map[plumbing.ReferenceName]RemoteReference, error) {
+	session, err := newUploadPackSession(url, auth)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	ar, err := session.AdvertisedReferences()
+	if err != nil {
+		return nil, fmt.Errorf("list remote references error: %w", err)
+	}
+
+	refs := make(map[plumbing.ReferenceName]RemoteReference, len(ar.References))
+	for name, hash := range ar.References {
+		ref := RemoteReference{Hash: hash, Commit: hash}
+		if peeled, ok := ar.Peeled[name]; ok {
+			ref.Commit = peeled
+		}
+		refs[plumbing.ReferenceName(name)] = ref
+	}
+	return refs, nil
+}
+
+// FetchReference fetches the reference from the remote repository into a
+// new repository in dir, and checks it out. Unlike clone, it accepts any
+// fully qualified reference, like refs/pull/1/head. All the tags are
+// fetched too with the AllTags mode, the other modes fetch none.
+func FetchReference(dir, url string, auth transport.AuthMethod, refName plumbing.ReferenceName, depth int, tags git.TagMode) (*git.Repository, error) {
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{url},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refSpecs := []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", refName, refName))}
+	if tags == git.AllTags {
+		refSpecs = append(refSpecs, "+refs/tags/*:refs/tags/*")
+	}
+	if err := Fetch(repo, url, auth, refSpecs, depth); err != nil {
+		return nil, err
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(refName))
+	if err != nil {
+		return nil, fmt.Errorf("resolve '%s': %w", refName, err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+		return nil, fmt.Errorf("checkout '%s': %w", refName, err)
+	}
+	return repo, nil
+}
+
+// Fetch fetches the references of the remote repository matching the
+// refspecs into the repository, with the transport of the auth method.
+// The references are always force updated and no tags are followed,
+// unless the refspecs list them. A depth of 0 fetches the whole history.
+//
+// go-git only resolves the transports from its global registry, the
+// fetch is negotiated here to use a transport of the repository's own.
+func Fetch(repo *git.Repository, url string, auth transport.AuthMethod, refSpecs []config.RefSpec, depth int) (err error) {
+	session, err := newUploadPackSession(url, auth)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := session.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	ar, err := session.AdvertisedReferences()
+	if err != nil {
+		return err
+	}
+	remoteRefs, err := ar.AllReferences()
+	if err != nil {
+		return err
+	}
+
+	refs, err := matchReferences(remoteRefs, refSpecs)
+	if err != nil {
+		return err
+	}
+
+	var wants []plumbing.Hash
+	seen := make(map[plumbing.Hash]bool)
+	for _, ref := range refs {
+		if seen[ref.Hash()] {
+			continue
+		}
+		seen[ref.Hash()] = true
+		if _, err := repo.Storer.EncodedObject(plumbing.AnyObject, ref.Hash()); err == plumbing.ErrObjectNotFound {
+			wants = append(wants, ref.Hash())
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(wants) > 0 {
+		if err := fetchPack(repo, session, ar, wants, depth); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range refs {
+		if err := repo.Storer.SetReference(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchReferences returns the remote references matching the refspecs,
+// named after their local destination.
+func matchReferences(remoteRefs storer.ReferenceStorer, refSpecs []config.RefSpec) ([]*plumbing.Reference, error) {
+	iter, err := remoteRefs.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+	var all []*plumbing.Reference
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		all = append(all, ref)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*plumbing.Reference
+	for _, rs := range refSpecs {
+		matched := false
+		for _, ref := range all {
+			if !rs.Match(ref.Name()) {
+				continue
+			}
+			target, err := storer.ResolveReference(remoteRefs, ref.Name())
+			if err != nil {
+				return nil, err
+			}
+			matched = true
+			refs = append(refs, plumbing.NewHashReference(rs.Dst(ref.Name()), target.Hash()))
+		}
+		if !matched && !rs.IsWildcard() {
+			return nil, fmt.Errorf("couldn't find remote ref %q", rs.Src())
+		}
+	}
+	return refs, nil
+}
+
+// fetchPack fetches the pack of the wanted objects into the repository,
+// telling the server about the local references tips.
+func fetchPack(repo *git.Repository, session transport.UploadPackSession, ar *packp.AdvRefs, wants []plumbing.Hash, depth int) (err error) {
+	req := packp.NewUploadPackRequestFromCapabilities(ar.Capabilities)
+	req.Wants = wants
+	if depth > 0 {
+		req.Depth = packp.DepthCommits(depth)
+		if err := req.Capabilities.Set(capability.Shallow); err != nil {
+			return err
+		}
+	}
+	if ar.Capabilities.Supports(capability.NoProgress) {
+		if err := req.Capabilities.Set(capability.NoProgress); err != nil {
+			return err
+		}
+	}
+
+	localRefs, err := repo.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+	haves := make(map[plumbing.Hash]bool)
+	err = localRefs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || haves[ref.Hash()] {
+			return nil
+		}
+		if _, err := repo.Storer.EncodedObject(plumbing.AnyObject, ref.Hash()); err == nil {
+			haves[ref.Hash()] = true
+			req.Haves = append(req.Haves, ref.Hash())
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := session.UploadPack(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := resp.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if depth > 0 && len(resp.Shallows) > 0 {
+		shallows, err := repo.Storer.Shallow()
+		if err != nil {
+			return err
+		}
+		known := make(map[plumbing.Hash]bool, len(shallows))
+		for _, h := range shallows {
+			known[h] = true
+		}
+		for _, h := range resp.Shallows {
+			if !known[h] {
+				shallows = append(shallows, h)
+			}
+		}
+		if err := repo.Storer.SetShallow(shallows); err != nil {
+			return err
+		}
+	}
+
+	var reader io.Reader = resp
+	switch {
+	case req.Capabilities.Supports(capability.Sideband64k):
+		reader = sideband.NewDemuxer(sideband.Sideband64k, resp)
+	case req.Capabilities.Supports(capability.Sideband):
+		reader = sideband.NewDemuxer(sideband.Sideband, resp)
+	}
+	return packfile.UpdateObjectStorage(repo.Storer, reader)
+}
+
+// newUploadPackSession opens an upload-pack session with the remote
+// repository, with the transport of the auth method.
+func newUploadPackSession(url string, auth transport.AuthMethod) (transport.UploadPackSession, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newTransport(ep, auth)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewUploadPackSession(ep, auth)
+}
@@ -0,0 +1,185 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func TestRemoteReferences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote-references")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	commit, err := w.Commit("initial", &git.CommitOptions{Author: signature})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateTag("v0.1.0", commit, nil); err != nil {
+		t.Fatal(err)
+	}
+	annotated, err := repo.CreateTag("v0.2.0", commit, &git.CreateTagOptions{Tagger: signature, Message: "v0.2.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := RemoteReferences(dir, nil)
+	if err != nil {
+		t.Fatalf("RemoteReferences() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		ref        plumbing.ReferenceName
+		wantHash   plumbing.Hash
+		wantCommit plumbing.Hash
+	}{
+		{"branch", plumbing.NewBranchReferenceName("master"), commit, commit},
+		{"lightweight tag", plumbing.NewTagReferenceName("v0.1.0"), commit, commit},
+		{"annotated tag", plumbing.NewTagReferenceName("v0.2.0"), annotated.Hash(), commit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := refs[tt.ref]
+			if !ok {
+				t.Fatalf("RemoteReferences() missing %s", tt.ref)
+			}
+			if got.Hash != tt.wantHash || got.Commit != tt.wantCommit {
+				t.Errorf("RemoteReferences() got = %v, want %v/%v", got, tt.wantHash, tt.wantCommit)
+			}
+		})
+	}
+
+	if _, err := RemoteReferences(dir+"-missing", nil); err == nil {
+		t.Error("RemoteReferences() expected error for missing repository")
+	}
+}
+
+func TestFetch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	origin, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := origin.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(msg string) plumbing.Hash {
+		hash, err := w.Commit(msg, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	commit("initial")
+
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refSpecs := []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"}
+	remoteRef := plumbing.NewRemoteReferenceName("origin", "master")
+
+	// the second fetch only gets the new commit
+	for _, msg := range []string{"first", "second"} {
+		want := commit(msg)
+		if err := Fetch(repo, dir, nil, refSpecs, 0); err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		ref, err := repo.Reference(remoteRef, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ref.Hash() != want {
+			t.Errorf("Fetch() %s = %s, want %s", remoteRef, ref.Hash(), want)
+		}
+		if _, err := repo.CommitObject(want); err != nil {
+			t.Errorf("Fetch() commit %s error = %v", want, err)
+		}
+	}
+
+	if err := Fetch(repo, dir, nil, []config.RefSpec{"+refs/heads/missing:refs/heads/missing"}, 0); err == nil {
+		t.Error("Fetch() expected error for missing reference")
+	}
+}
+
+func TestFetchReference(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "fetch-reference")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	origin := filepath.Join(tmp, "origin")
+	repo, err := git.PlainInit(origin, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(origin, "file"), []byte("pull"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("file"); err != nil {
+		t.Fatal(err)
+	}
+	commit, err := w.Commit("pull", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pullRef := plumbing.ReferenceName("refs/pull/1/head")
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(pullRef, commit)); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(tmp, "checkout")
+	fetched, err := FetchReference(dir, origin, nil, pullRef, 1, git.NoTags)
+	if err != nil {
+		t.Fatalf("FetchReference() error = %v", err)
+	}
+	head, err := fetched.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Hash() != commit {
+		t.Errorf("FetchReference() HEAD = %s, want %s", head.Hash(), commit)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "file")); err != nil || string(b) != "pull" {
+		t.Errorf("FetchReference() checkout = %s, %v", b, err)
+	}
+
+	if _, err := FetchReference(filepath.Join(tmp, "missing"), origin, nil, "refs/pull/2/head", 1, git.NoTags); err == nil {
+		t.Error("FetchReference() expected error for missing reference")
+	}
+}
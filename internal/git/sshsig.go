@@ -0,0 +1,255 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// sshSigNamespace is the namespace of the SSH signatures made by git.
+	sshSigNamespace = "git"
+
+	sshSigMagic   = "SSHSIG"
+	sshSigVersion = 1
+	sshSigType    = "SSH SIGNATURE"
+)
+
+// AllowedSigner is an entry of an allowed signers file, as used by
+// 'ssh-keygen -Y verify' and git's gpg.ssh.allowedSignersFile.
+type AllowedSigner struct {
+	// Principals are the identities of the signer, e.g. email addresses.
+	Principals []string
+
+	// Namespaces are the signature namespaces the key is allowed to sign
+	// in, any namespace when empty.
+	Namespaces []string
+
+	// ValidAfter is the time the key is valid from, if not zero.
+	ValidAfter time.Time
+
+	// ValidBefore is the time the key is valid until, if not zero.
+	ValidBefore time.Time
+
+	// Key is the public key of the signer.
+	Key ssh.PublicKey
+}
+
+// ParseAllowedSigners parses the allowed signers file format: one signer
+// per line, made of a comma separated list of principals, optional
+// options and the public key in the authorized_keys format. The
+// namespaces, valid-after and valid-before options are supported, the
+// times are in UTC. Empty lines and comments are ignored.
+func ParseAllowedSigners(data []byte) ([]AllowedSigner, error) {
+	var signers []AllowedSigner
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("allowed signers line %d: missing public key", n)
+		}
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("allowed signers line %d: %w", n, err)
+		}
+
+		signer := AllowedSigner{Principals: strings.Split(fields[0], ","), Key: key}
+		for _, option := range options {
+			name := strings.SplitN(option, "=", 2)
+			if len(name) != 2 {
+				continue
+			}
+			value := strings.Trim(name[1], `"`)
+			switch strings.ToLower(name[0]) {
+			case "namespaces":
+				signer.Namespaces = strings.Split(value, ",")
+			case "valid-after":
+				signer.ValidAfter, err = parseSSHTime(value)
+			case "valid-before":
+				signer.ValidBefore, err = parseSSHTime(value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("allowed signers line %d: %w", n, err)
+			}
+		}
+		signers = append(signers, signer)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return signers, nil
+}
+
+// ParseRevokedKeys parses the public keys in the authorized_keys format,
+// one per line. Empty lines and comments are ignored.
+func ParseRevokedKeys(data []byte) ([]ssh.PublicKey, error) {
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(data)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("revoked keys error: %w", err)
+		}
+		keys = append(keys, key)
+		data = rest
+	}
+	return keys, nil
+}
+
+// parseSSHTime parses the YYYYMMDD[HHMM[SS]][Z] time format of the
+// allowed signers options.
+func parseSSHTime(value string) (time.Time, error) {
+	value = strings.TrimSuffix(value, "Z")
+	for _, layout := range []string{"20060102", "200601021504", "20060102150405"} {
+		if len(value) == len(layout) {
+			return time.Parse(layout, value)
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s'", value)
+}
+
+// allows returns if the signer may sign in the namespace.
+func (s AllowedSigner) allows(namespace string) bool {
+	if len(s.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range s.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// sshSignature is the binary format of an SSH signature, see
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig.
+type sshSignature struct {
+	Magic         [6]byte
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSignedData is the data signed by an SSH signature.
+type sshSignedData struct {
+	Magic         [6]byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// matches returns the principal of the signer matching the email, which
+// is matched against the principal patterns. Any email matches the first
+// principal when empty.
+func (s AllowedSigner) matches(email string) (string, bool) {
+	if email == "" {
+		return s.Principals[0], true
+	}
+	for _, principal := range s.Principals {
+		if ok, _ := path.Match(strings.ToLower(principal), strings.ToLower(email)); ok {
+			return email, true
+		}
+	}
+	return "", false
+}
+
+// verifySSH verifies the armored SSH signature of the message made in
+// the git namespace, at the given time by an allowed signer bound to the
+// email if not empty.
+func (v *Verifier) verifySSH(armored string, message []byte, email string, when time.Time) (*Signer, error) {
+	block, _ := pem.Decode([]byte(armored))
+	if block == nil || block.Type != sshSigType {
+		return nil, fmt.Errorf("invalid SSH signature armor")
+	}
+
+	var sig sshSignature
+	if err := ssh.Unmarshal(block.Bytes, &sig); err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	if string(sig.Magic[:]) != sshSigMagic || sig.Version != sshSigVersion {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", sig.Version)
+	}
+	if sig.Namespace != sshSigNamespace {
+		return nil, fmt.Errorf("SSH signature namespace '%s' is not '%s'", sig.Namespace, sshSigNamespace)
+	}
+
+	key, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH signature public key: %w", err)
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported SSH signature hash algorithm '%s'", sig.HashAlgorithm)
+	}
+	h.Write(message)
+
+	signed := sshSignedData{
+		Namespace:     sig.Namespace,
+		Reserved:      sig.Reserved,
+		HashAlgorithm: sig.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	}
+	copy(signed.Magic[:], sshSigMagic)
+
+	signature := new(ssh.Signature)
+	if err := ssh.Unmarshal(sig.Signature, signature); err != nil {
+		return nil, fmt.Errorf("invalid SSH signature blob: %w", err)
+	}
+	if err := key.Verify(ssh.Marshal(signed), signature); err != nil {
+		return nil, fmt.Errorf("SSH signature error: %w", err)
+	}
+
+	fingerprint := ssh.FingerprintSHA256(key)
+	for _, revoked := range v.RevokedKeys {
+		if bytes.Equal(revoked.Marshal(), key.Marshal()) {
+			return nil, fmt.Errorf("key '%s' is revoked", fingerprint)
+		}
+	}
+
+	// the key may be listed several times, with different principals and
+	// validity periods, the first entry accepting the signature is used
+	err = fmt.Errorf("key '%s' is not an allowed signer", fingerprint)
+	for _, signer := range v.AllowedSigners {
+		if !bytes.Equal(signer.Key.Marshal(), key.Marshal()) || !signer.allows(sig.Namespace) {
+			continue
+		}
+		if !signer.ValidAfter.IsZero() && when.Before(signer.ValidAfter) {
+			err = fmt.Errorf("key '%s' was not valid yet at %s", fingerprint, when.UTC().Format(time.RFC3339))
+			continue
+		}
+		if !signer.ValidBefore.IsZero() && when.After(signer.ValidBefore) {
+			err = fmt.Errorf("key '%s' was expired at %s", fingerprint, when.UTC().Format(time.RFC3339))
+			continue
+		}
+		principal, ok := signer.matches(email)
+		if !ok {
+			err = fmt.Errorf("key '%s' has no principal for '%s'", fingerprint, email)
+			continue
+		}
+		return &Signer{Fingerprint: fingerprint, Identity: principal}, nil
+	}
+	return nil, err
+}
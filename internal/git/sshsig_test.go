@@ -0,0 +1,216 @@
+package git
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"fmt"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHSigner returns a new ed25519 SSH signer.
+func testSSHSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// testSSHSign returns the armored SSH signature of the message, like
+// 'ssh-keygen -Y sign -n <namespace>' does.
+func testSSHSign(t *testing.T, signer ssh.Signer, message []byte, namespace string) string {
+	h := sha512.Sum512(message)
+	signed := sshSignedData{Namespace: namespace, HashAlgorithm: "sha512", Hash: h[:]}
+	copy(signed.Magic[:], sshSigMagic)
+
+	signature, err := signer.Sign(rand.Reader, ssh.Marshal(signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := sshSignature{
+		Version:       sshSigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(signature),
+	}
+	copy(sig.Magic[:], sshSigMagic)
+	return string(pem.EncodeToMemory(&pem.Block{Type: sshSigType, Bytes: ssh.Marshal(sig)}))
+}
+
+func TestParseAllowedSigners(t *testing.T) {
+	key := string(ssh.MarshalAuthorizedKey(testSSHSigner(t).PublicKey()))
+
+	tests := []struct {
+		name           string
+		data           string
+		wantPrincipals []string
+		wantNamespaces []string
+		wantErr        bool
+	}{
+		{"principal", "dev@example.com " + key, []string{"dev@example.com"}, nil, false},
+		{"principals", "dev@example.com,ops@example.com " + key, []string{"dev@example.com", "ops@example.com"}, nil, false},
+		{"namespaces", `dev@example.com namespaces="git,file" ` + key, []string{"dev@example.com"}, []string{"git", "file"}, false},
+		{"comments", "# signers\n\ndev@example.com " + key, []string{"dev@example.com"}, nil, false},
+		{"validity", `dev@example.com valid-after="20200101",valid-before="20300101Z" ` + key, []string{"dev@example.com"}, nil, false},
+		{"invalid validity", `dev@example.com valid-before="2030" ` + key, nil, nil, true},
+		{"missing key", "dev@example.com", nil, nil, true},
+		{"invalid key", "dev@example.com ssh-ed25519 invalid", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signers, err := ParseAllowedSigners([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAllowedSigners() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(signers) != 1 {
+				t.Fatalf("ParseAllowedSigners() got %d signers, want 1", len(signers))
+			}
+			if got := fmt.Sprint(signers[0].Principals); got != fmt.Sprint(tt.wantPrincipals) {
+				t.Errorf("ParseAllowedSigners() principals = %v, want %v", got, tt.wantPrincipals)
+			}
+			if got := fmt.Sprint(signers[0].Namespaces); got != fmt.Sprint(tt.wantNamespaces) {
+				t.Errorf("ParseAllowedSigners() namespaces = %v, want %v", got, tt.wantNamespaces)
+			}
+		})
+	}
+}
+
+func TestVerifier_verifySSH(t *testing.T) {
+	signer := testSSHSigner(t)
+	other := testSSHSigner(t)
+	message := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n")
+	signers := []AllowedSigner{
+		{Principals: []string{"dev@example.com"}, Key: signer.PublicKey()},
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		message   []byte
+		signers   []AllowedSigner
+		want      string
+		wantErr   bool
+	}{
+		{"allowed signer", testSSHSign(t, signer, message, "git"), message, signers, "dev@example.com", false},
+		{"unknown signer", testSSHSign(t, other, message, "git"), message, signers, "", true},
+		{"modified message", testSSHSign(t, signer, message, "git"), []byte("tree\n"), signers, "", true},
+		{"file namespace", testSSHSign(t, signer, message, "file"), message, signers, "", true},
+		{"namespace not allowed", testSSHSign(t, signer, message, "git"), message, []AllowedSigner{
+			{Principals: []string{"dev@example.com"}, Namespaces: []string{"file"}, Key: signer.PublicKey()},
+		}, "", true},
+		{"not valid yet", testSSHSign(t, signer, message, "git"), message, []AllowedSigner{
+			{Principals: []string{"dev@example.com"}, ValidAfter: time.Now().Add(time.Hour), Key: signer.PublicKey()},
+		}, "", true},
+		{"invalid armor", "-----BEGIN PGP SIGNATURE-----\n", message, signers, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Verifier{AllowedSigners: tt.signers}
+			got, err := v.verifySSH(tt.signature, tt.message, "", time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifySSH() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Identity != tt.want {
+				t.Errorf("verifySSH() identity = %v, want %v", got.Identity, tt.want)
+			}
+			if got.Fingerprint != ssh.FingerprintSHA256(signer.PublicKey()) {
+				t.Errorf("verifySSH() fingerprint = %v", got.Fingerprint)
+			}
+		})
+	}
+}
+
+// testSSHVector is a commit payload signed with 'ssh-keygen -Y sign -n git',
+// and the allowed signers verifying it with 'ssh-keygen -Y verify'.
+const (
+	testSSHVectorMessage = "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"author dev <dev@example.com> 1600000000 +0000\n" +
+		"committer dev <dev@example.com> 1600000000 +0000\n" +
+		"\n" +
+		"signed commit\n"
+
+	testSSHVectorSignature = `-----BEGIN SSH SIGNATURE-----
+U1NIU0lHAAAAAQAAADMAAAALc3NoLWVkMjU1MTkAAAAgvsoHArnPXwEsHNUCi25e1aEXZJ
+MtUcC6SkDgnF24mdIAAAADZ2l0AAAAAAAAAAZzaGE1MTIAAABTAAAAC3NzaC1lZDI1NTE5
+AAAAQM+i+OmYlCAlLwwHL2RG4T0JWjFBekMDSen9nVMwGY9sZQbpa17nHSEbvhMOGHX/+K
+Esi5aaJWF/qmadKpfSMgA=
+-----END SSH SIGNATURE-----
+`
+
+	testSSHVectorKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIL7KBwK5z18BLBzVAotuXtWhF2STLVHAukpA4JxduJnS dev@example.com"
+)
+
+func TestVerifier_verifySSHVector(t *testing.T) {
+	when := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		name           string
+		allowedSigners string
+		email          string
+		want           string
+		wantErr        bool
+	}{
+		{"allowed signer", "dev@example.com " + testSSHVectorKey, "dev@example.com", "dev@example.com", false},
+		{"namespace", `dev@example.com namespaces="git" ` + testSSHVectorKey, "", "dev@example.com", false},
+		{"other principal", "ops@example.com " + testSSHVectorKey, "dev@example.com", "", true},
+		{"expired", `dev@example.com valid-before="20200101" ` + testSSHVectorKey, "", "", true},
+		{"expired entry then valid entry", `dev@example.com valid-before="20200101" ` + testSSHVectorKey + "\n" +
+			`dev@example.com valid-after="20200101" ` + testSSHVectorKey, "", "dev@example.com", false},
+		{"other principal then bound entry", "ops@example.com " + testSSHVectorKey + "\n" +
+			"dev@example.com " + testSSHVectorKey, "dev@example.com", "dev@example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signers, err := ParseAllowedSigners([]byte(tt.allowedSigners))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v := &Verifier{AllowedSigners: signers}
+			got, err := v.verifySSH(testSSHVectorSignature, []byte(testSSHVectorMessage), tt.email, when)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifySSH() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Identity != tt.want {
+				t.Errorf("verifySSH() identity = %v, want %v", got.Identity, tt.want)
+			}
+			if want := "SHA256:9qWdyWCPXovD91hAxJ04H/0ExnnPxUiz2lycIgs12bo"; got.Fingerprint != want {
+				t.Errorf("verifySSH() fingerprint = %v, want %v", got.Fingerprint, want)
+			}
+		})
+	}
+}
+
+func TestParseRevokedKeys(t *testing.T) {
+	first := ssh.MarshalAuthorizedKey(testSSHSigner(t).PublicKey())
+	second := ssh.MarshalAuthorizedKey(testSSHSigner(t).PublicKey())
+
+	keys, err := ParseRevokedKeys(append(append([]byte("# revoked\n"), first...), second...))
+	if err != nil {
+		t.Fatalf("ParseRevokedKeys() error = %v", err)
+	}
+	if len(keys) != 2 {
+		t.Errorf("ParseRevokedKeys() got %d keys, want 2", len(keys))
+	}
+	if _, err := ParseRevokedKeys([]byte("ssh-ed25519 invalid")); err == nil {
+		t.Error("ParseRevokedKeys() expected error for invalid key")
+	}
+}
@@ -0,0 +1,115 @@
+package git
+
+import (
+	"fmt"
+	neturl "net/url"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// SubmoduleAuthFunc returns the auth method for the URL of a submodule,
+// and an optional func cleaning up after it.
+type SubmoduleAuthFunc func(url string) (transport.AuthMethod, func(), error)
+
+// UpdateSubmodules checks out the submodules of the repository cloned
+// from url, and their nested submodules up to depth, at the commits
+// recorded in the repository. It returns the checked out commits by
+// submodule path.
+func UpdateSubmodules(repo *git.Repository, url string, authFunc SubmoduleAuthFunc, depth git.SubmoduleRescursivity) (map[string]string, error) {
+	commits := make(map[string]string)
+	if err := updateSubmodules(repo, url, "", authFunc, depth, commits); err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+func updateSubmodules(repo *git.Repository, url, prefix string, authFunc SubmoduleAuthFunc, depth git.SubmoduleRescursivity, commits map[string]string) error {
+	if depth == git.NoRecurseSubmodules {
+		return nil
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	submodules, err := w.Submodules()
+	if err != nil {
+		return err
+	}
+
+	for _, submodule := range submodules {
+		cfg := submodule.Config()
+		subPath := path.Join(prefix, cfg.Path)
+		cfg.URL = resolveSubmoduleURL(url, cfg.URL)
+
+		auth, cleanup, err := authFunc(cfg.URL)
+		if err != nil {
+			return fmt.Errorf("submodule '%s' auth error: %w", subPath, err)
+		}
+		subRepo, commit, err := updateSubmodule(submodule, auth)
+		if cleanup != nil {
+			cleanup()
+		}
+		if err != nil {
+			return fmt.Errorf("submodule '%s' update error: %w", subPath, err)
+		}
+		commits[subPath] = commit.String()
+
+		if err := updateSubmodules(subRepo, cfg.URL, subPath, authFunc, depth-1, commits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateSubmodule fetches the branches of the submodule with the auth
+// method, and checks out the commit recorded in the parent repository.
+func updateSubmodule(submodule *git.Submodule, auth transport.AuthMethod) (*git.Repository, plumbing.Hash, error) {
+	if err := submodule.Init(); err != nil && err != git.ErrSubmoduleAlreadyInitialized {
+		return nil, plumbing.ZeroHash, err
+	}
+	status, err := submodule.Status()
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	repo, err := submodule.Repository()
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+
+	refSpecs := []config.RefSpec{config.RefSpec(fmt.Sprintf(config.DefaultFetchRefSpec, git.DefaultRemoteName))}
+	if err := Fetch(repo, submodule.Config().URL, auth, refSpecs, 0); err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Hash: status.Expected, Force: true}); err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("checkout '%s': %w", status.Expected, err)
+	}
+	return repo, status.Expected, nil
+}
+
+// resolveSubmoduleURL resolves a submodule URL relative to the URL of
+// its parent repository, like 'git submodule' does for URLs starting
+// with './' or '../'.
+func resolveSubmoduleURL(base, url string) string {
+	if !strings.HasPrefix(url, "./") && !strings.HasPrefix(url, "../") {
+		return url
+	}
+	if u, err := neturl.Parse(base); err == nil && u.Scheme != "" {
+		u.Path = path.Join(u.Path, url)
+		return u.String()
+	}
+	// scp-like addresses, e.g. git@github.com:org/repo
+	if i := strings.Index(base, ":"); i > 0 && !strings.HasPrefix(base, "/") {
+		return base[:i+1] + path.Join(base[i+1:], url)
+	}
+	return path.Join(base, url)
+}
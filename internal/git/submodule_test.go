@@ -0,0 +1,117 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+func TestUpdateSubmodules(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "submodules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	commit := func(repo *git.Repository, files map[string]string) plumbing.Hash {
+		w, err := repo.Worktree()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(w.Filesystem.Root(), name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Add(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		hash, err := w.Commit("commit", &git.CommitOptions{Author: signature})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	lib, err := git.PlainInit(filepath.Join(tmp, "lib"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	libCommit := commit(lib, map[string]string{"base.yaml": "lib"})
+
+	app, err := git.PlainInit(filepath.Join(tmp, "app"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := app.Storer.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Entries = append(idx.Entries, &index.Entry{Name: "bases/lib", Hash: libCommit, Mode: filemode.Submodule})
+	if err := app.Storer.SetIndex(idx); err != nil {
+		t.Fatal(err)
+	}
+	commit(app, map[string]string{".gitmodules": "[submodule \"lib\"]\n\tpath = bases/lib\n\turl = ../lib\n"})
+
+	dir := filepath.Join(tmp, "clone")
+	url := filepath.Join(tmp, "app")
+	repo, err := git.PlainClone(dir, false, &git.CloneOptions{URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var authURLs []string
+	authFunc := func(url string) (transport.AuthMethod, func(), error) {
+		authURLs = append(authURLs, url)
+		return nil, nil, nil
+	}
+	commits, err := UpdateSubmodules(repo, url, authFunc, git.DefaultSubmoduleRecursionDepth)
+	if err != nil {
+		t.Fatalf("UpdateSubmodules() error = %v", err)
+	}
+
+	if got := commits["bases/lib"]; got != libCommit.String() {
+		t.Errorf("UpdateSubmodules() commit = %v, want %v", got, libCommit)
+	}
+	if len(authURLs) != 1 || authURLs[0] != filepath.Join(tmp, "lib") {
+		t.Errorf("UpdateSubmodules() auth URLs = %v", authURLs)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "bases", "lib", "base.yaml"))
+	if err != nil {
+		t.Fatalf("submodule not checked out: %v", err)
+	}
+	if string(content) != "lib" {
+		t.Errorf("submodule content = %s", content)
+	}
+}
+
+func TestResolveSubmoduleURL(t *testing.T) {
+	tests := []struct {
+		base string
+		url  string
+		want string
+	}{
+		{"https://github.com/org/app.git", "https://github.com/org/lib.git", "https://github.com/org/lib.git"},
+		{"https://github.com/org/app.git", "../lib.git", "https://github.com/org/lib.git"},
+		{"ssh://git@github.com/org/app", "./lib", "ssh://git@github.com/org/app/lib"},
+		{"git@github.com:org/app.git", "../lib.git", "git@github.com:org/lib.git"},
+		{"/srv/git/app", "../lib", "/srv/git/lib"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := resolveSubmoduleURL(tt.base, tt.url); got != tt.want {
+				t.Errorf("resolveSubmoduleURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
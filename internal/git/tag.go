@@ -0,0 +1,206 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+)
+
+const (
+	// PrereleaseInclude selects prerelease versions matching the range.
+	PrereleaseInclude = "include"
+
+	// PrereleaseExclude ignores all prerelease versions.
+	PrereleaseExclude = "exclude"
+
+	// PrereleaseIncludeOnlyForRange selects a prerelease version only when
+	// the range holds a prerelease of the same major, minor and patch
+	// version, e.g. 1.2.0-rc.2 for '>=1.2.0-rc.1 <2.0.0' but not 1.3.0-rc.1.
+	PrereleaseIncludeOnlyForRange = "include-only-for-range"
+)
+
+const (
+	// TagOrderAlphabetical orders the tags alphabetically.
+	TagOrderAlphabetical = "alphabetical"
+
+	// TagOrderNumerical orders the tags by their numerical value.
+	TagOrderNumerical = "numerical"
+
+	// TagOrderDate orders the tags by date.
+	TagOrderDate = "date"
+)
+
+// LatestTag returns the last tag in the order. When the include pattern
+// is set, only the matching tags are considered, and the value ordered
+// alphabetically or numerically is read from the first capture group of
+// the pattern, or from the whole match if the pattern has no group.
+// Tags without a numerical value are ignored by the numerical order, and
+// tags without a date by the date order.
+func LatestTag(tags []string, order, include string, dates map[string]time.Time) (string, error) {
+	var re *regexp.Regexp
+	if include != "" {
+		var err error
+		if re, err = regexp.Compile(include); err != nil {
+			return "", fmt.Errorf("tag include pattern parse error: %w", err)
+		}
+	}
+
+	type candidate struct {
+		tag    string
+		value  string
+		number float64
+		date   time.Time
+	}
+	var candidates []candidate
+	for _, tag := range tags {
+		value, ok := matchTag(re, tag)
+		if !ok {
+			continue
+		}
+		c := candidate{tag: tag, value: value}
+		switch order {
+		case TagOrderAlphabetical:
+		case TagOrderNumerical:
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			c.number = number
+		case TagOrderDate:
+			date, ok := dates[tag]
+			if !ok {
+				continue
+			}
+			c.date = date
+		default:
+			return "", fmt.Errorf("unsupported tag order '%s'", order)
+		}
+		candidates = append(candidates, c)
+	}
+
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no tag found for %s order", order)
+	}
+
+	// ties are broken by tag name so the selection is stable
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch {
+		case order == TagOrderNumerical && a.number != b.number:
+			return a.number < b.number
+		case order == TagOrderDate && !a.date.Equal(b.date):
+			return a.date.Before(b.date)
+		case order == TagOrderAlphabetical && a.value != b.value:
+			return a.value < b.value
+		}
+		return a.tag < b.tag
+	})
+	return candidates[len(candidates)-1].tag, nil
+}
+
+// LatestSemverTag returns the tag of the highest version matching the
+// semver range. The prerelease policy defaults to PrereleaseInclude.
+// When the pattern is set, only the matching tags are considered, and
+// the version is read from the first capture group of the pattern, or
+// from the whole match if the pattern has no group.
+func LatestSemverTag(tags []string, exp, prerelease, pattern string) (string, error) {
+	rng, err := semver.ParseRange(exp)
+	if err != nil {
+		return "", fmt.Errorf("semver parse range error: %w", err)
+	}
+
+	var re *regexp.Regexp
+	if pattern != "" {
+		if re, err = regexp.Compile(pattern); err != nil {
+			return "", fmt.Errorf("tag pattern parse error: %w", err)
+		}
+	}
+
+	var rangePrereleases []semver.Version
+	switch prerelease {
+	case "", PrereleaseInclude, PrereleaseExclude:
+	case PrereleaseIncludeOnlyForRange:
+		rangePrereleases = prereleasesOf(exp)
+	default:
+		return "", fmt.Errorf("unsupported prerelease policy '%s'", prerelease)
+	}
+
+	// iterate in order so equal versions always resolve to the same tag
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+
+	var latest *semver.Version
+	var latestTag string
+	for _, tag := range sorted {
+		version, ok := matchTag(re, tag)
+		if !ok {
+			continue
+		}
+
+		v, err := semver.ParseTolerant(version)
+		if err != nil || !rng(v) {
+			continue
+		}
+		if len(v.Pre) > 0 {
+			if prerelease == PrereleaseExclude {
+				continue
+			}
+			if prerelease == PrereleaseIncludeOnlyForRange && !hasPrereleaseOf(rangePrereleases, v) {
+				continue
+			}
+		}
+
+		if latest == nil || v.GT(*latest) {
+			latest = &v
+			latestTag = tag
+		}
+	}
+
+	if latest == nil {
+		return "", fmt.Errorf("no match found for semver: %s", exp)
+	}
+	return latestTag, nil
+}
+
+// matchTag returns the value of the tag matched by the pattern, from
+// the first capture group or from the whole match. A nil pattern matches
+// the whole tag.
+func matchTag(re *regexp.Regexp, tag string) (string, bool) {
+	if re == nil {
+		return tag, true
+	}
+	match := re.FindStringSubmatch(tag)
+	if match == nil {
+		return "", false
+	}
+	if len(match) > 1 {
+		return match[1], true
+	}
+	return match[0], true
+}
+
+// prereleasesOf returns the prerelease versions of the range comparators.
+func prereleasesOf(exp string) []semver.Version {
+	var versions []semver.Version
+	for _, field := range strings.Fields(strings.Replace(exp, "||", " ", -1)) {
+		v, err := semver.ParseTolerant(strings.TrimLeft(field, "<>=!~^"))
+		if err == nil && len(v.Pre) > 0 {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+func hasPrereleaseOf(versions []semver.Version, v semver.Version) bool {
+	for _, rv := range versions {
+		if rv.Major == v.Major && rv.Minor == v.Minor && rv.Patch == v.Patch {
+			return true
+		}
+	}
+	return false
+}
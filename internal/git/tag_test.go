@@ -0,0 +1,84 @@
+package git
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatestSemverTag(t *testing.T) {
+	tags := []string{"v1.0.0", "1.1.0", "v1.2.0-rc.1", "v1.2.0", "v1.3.0-rc.1", "v2.0.0", "latest",
+		"app-v1.4.0", "app-v1.5.0-rc.1", "lib-v3.0.0"}
+	tests := []struct {
+		name       string
+		exp        string
+		prerelease string
+		pattern    string
+		want       string
+		wantErr    bool
+	}{
+		{"highest in range", "<2.0.0", "", "", "v1.3.0-rc.1", false},
+		{"exclude prereleases", "<2.0.0", PrereleaseExclude, "", "v1.2.0", false},
+		{"prerelease of range", ">=1.2.0-rc.1 <1.3.0", PrereleaseIncludeOnlyForRange, "", "v1.2.0", false},
+		{"prerelease outside of range prerelease", ">=1.2.0-rc.1 <2.0.0", PrereleaseIncludeOnlyForRange, "", "v1.2.0", false},
+		{"prerelease in range", ">=1.3.0-rc.1 <2.0.0", PrereleaseIncludeOnlyForRange, "", "v1.3.0-rc.1", false},
+		{"tolerant versions", "<1.2.0-0", "", "", "1.1.0", false},
+		{"pattern capture group", ">=1.0.0", "", `^app-v(.*)$`, "app-v1.5.0-rc.1", false},
+		{"pattern with exclude", ">=1.0.0", PrereleaseExclude, `^app-v(.*)$`, "app-v1.4.0", false},
+		{"pattern without group", ">=3.0.0", "", `3\.\d+\.\d+$`, "lib-v3.0.0", false},
+		{"no match", ">=3.0.0", "", "", "", true},
+		{"invalid range", "not a range", "", "", "", true},
+		{"invalid pattern", ">=1.0.0", "", "(", "", true},
+		{"invalid policy", ">=1.0.0", "all", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LatestSemverTag(tags, tt.exp, tt.prerelease, tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LatestSemverTag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("LatestSemverTag() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatestTag(t *testing.T) {
+	tags := []string{"2020.05.12", "2020.11.02", "2019.12.31", "build-9", "build-10", "build-x", "latest"}
+	now := time.Now()
+	dates := map[string]time.Time{
+		"2020.05.12": now.Add(-time.Hour),
+		"2020.11.02": now.Add(-2 * time.Hour),
+		"build-10":   now.Add(-3 * time.Hour),
+	}
+	tests := []struct {
+		name    string
+		order   string
+		include string
+		want    string
+		wantErr bool
+	}{
+		{"alphabetical", TagOrderAlphabetical, "", "latest", false},
+		{"alphabetical with include", TagOrderAlphabetical, `^\d{4}\.\d{2}\.\d{2}$`, "2020.11.02", false},
+		{"numerical with capture group", TagOrderNumerical, `^build-(.*)$`, "build-10", false},
+		{"numerical without numbers", TagOrderNumerical, "", "", true},
+		{"date", TagOrderDate, "", "2020.05.12", false},
+		{"date with include", TagOrderDate, `^build-`, "build-10", false},
+		{"no match", TagOrderAlphabetical, `^v`, "", true},
+		{"invalid include", TagOrderAlphabetical, "(", "", true},
+		{"invalid order", "semver", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LatestTag(tags, tt.order, tt.include, dates)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LatestTag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("LatestTag() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,29 +1,114 @@
 package git
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
 	corev1 "k8s.io/api/core/v1"
 )
 
+// NewEndpoint parses the URL of a git repository into a transport
+// endpoint. Besides http, https, ssh and git URLs, it accepts the
+// scp-like syntax of SSH addresses, e.g. git@github.com:org/repo.git.
+// Local paths and file URLs are refused, they would read the filesystem
+// of the controller.
+func NewEndpoint(url string) (*transport.Endpoint, error) {
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid git URL '%s': %w", url, err)
+	}
+	switch ep.Protocol {
+	case "http", "https", "ssh", "git":
+		return ep, nil
+	}
+	return nil, fmt.Errorf("unsupported git URL scheme '%s'", ep.Protocol)
+}
+
+// AuthMethodFromSecret returns the auth method for the scheme of the URL,
+// basic auth and TLS for http and https URLs, public keys for SSH
+// addresses. The secret can't be used with the unauthenticated git://
+// protocol, URLs of the other schemes have no auth method.
 func AuthMethodFromSecret(url string, secret corev1.Secret) (transport.AuthMethod, func(), error) {
-	switch {
-	case strings.HasPrefix(url, "http"):
-		auth, err := BasicAuthFromSecret(secret)
-		return auth, nil, err
-	case strings.HasPrefix(url, "ssh"):
-		return PublicKeysFromSecret(secret)
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch ep.Protocol {
+	case "http", "https":
+		return HTTPAuthFromSecret(secret)
+	case "ssh":
+		auth, cleanup, err := PublicKeysFromSecret(secret)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ep.User != "" {
+			auth.User = ep.User
+		}
+		return auth, cleanup, nil
+	case "git":
+		return nil, nil, fmt.Errorf("the '%s' secret can't be used with the unauthenticated git:// protocol", secret.Name)
 	}
 	return nil, nil, nil
 }
 
+// HTTPAuthFromSecret returns the basic auth of the 'username' and
+// 'password' of the secret, the token auth of its 'bearerToken', or the
+// basic auth of the installation token of its GitHub App. When
+// the secret holds TLS files, it returns an HTTPAuth with their TLS config
+// instead, with optional credentials, and a func closing its connections.
+func HTTPAuthFromSecret(secret corev1.Secret) (transport.AuthMethod, func(), error) {
+	tlsConfig, err := TLSConfigFromSecret(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	app, err := GitHubAppFromSecret(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	token := strings.TrimSpace(string(secret.Data["bearerToken"]))
+	hasBasicAuth := len(secret.Data["username"])+len(secret.Data["password"]) > 0
+	var credentials http.AuthMethod
+	switch {
+	case app != nil && (token != "" || hasBasicAuth):
+		return nil, nil, fmt.Errorf("invalid '%s' secret data: GitHub App fields can't be set with 'bearerToken', 'username' and 'password'", secret.Name)
+	case token != "" && hasBasicAuth:
+		return nil, nil, fmt.Errorf("invalid '%s' secret data: 'bearerToken' can't be set with 'username' and 'password'", secret.Name)
+	case app != nil:
+		basicAuth, err := DefaultGitHubAppProvider.AuthMethod(app)
+		if err != nil {
+			return nil, nil, err
+		}
+		credentials = basicAuth
+	case token != "":
+		credentials = &http.TokenAuth{Token: token}
+	case hasBasicAuth || tlsConfig == nil:
+		basicAuth, err := BasicAuthFromSecret(secret)
+		if err != nil {
+			return nil, nil, err
+		}
+		credentials = basicAuth
+	}
+	if tlsConfig == nil {
+		return credentials, nil, nil
+	}
+
+	auth := NewHTTPAuth(credentials, tlsConfig)
+	return auth, auth.CloseIdleConnections, nil
+}
+
 func BasicAuthFromSecret(secret corev1.Secret) (*http.BasicAuth, error) {
 	auth := &http.BasicAuth{}
 	if username, ok := secret.Data["username"]; ok {
@@ -38,16 +123,20 @@ func BasicAuthFromSecret(secret corev1.Secret) (*http.BasicAuth, error) {
 	return auth, nil
 }
 
-func PublicKeysFromSecret(secret corev1.Secret) (*ssh.PublicKeys, func(), error) {
+// PublicKeysFromSecret returns the SSH auth method of the 'git' user
+// with the 'identity' private key of the secret, decrypted with the
+// 'password' passphrase if set, which verifies the host keys with the
+// 'known_hosts' of the secret.
+func PublicKeysFromSecret(secret corev1.Secret) (*SSHAuth, func(), error) {
 	identity := secret.Data["identity"]
 	knownHosts := secret.Data["known_hosts"]
 	if len(identity) == 0 || len(knownHosts) == 0 {
 		return nil, nil, fmt.Errorf("invalid '%s' secret data: required fields 'identity' and 'known_hosts'", secret.Name)
 	}
 
-	pk, err := ssh.NewPublicKeys("git", identity, "")
+	pk, err := ssh.NewPublicKeys("git", identity, string(secret.Data["password"]))
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("invalid '%s' secret identity: %w", secret.Name, err)
 	}
 
 	// create tmp dir for known_hosts
@@ -69,5 +158,128 @@ func PublicKeysFromSecret(secret corev1.Secret) (*ssh.PublicKeys, func(), error)
 		return nil, nil, err
 	}
 	pk.HostKeyCallback = callback
-	return pk, cleanup, nil
+	return &SSHAuth{PublicKeys: pk}, cleanup, nil
+}
+
+// SSHAuth is the public keys auth method of SSH addresses, which can
+// restrict the algorithms negotiated with the server, and records the
+// host key verification and public key authentication failures.
+type SSHAuth struct {
+	*ssh.PublicKeys
+
+	// HostKeyAlgorithms are the accepted host key algorithms, in order of
+	// preference. The defaults are used when empty.
+	HostKeyAlgorithms []string
+
+	// KexAlgorithms are the accepted key exchange algorithms, in order of
+	// preference. The defaults are used when empty.
+	KexAlgorithms []string
+
+	// Ciphers are the accepted ciphers, in order of preference. The
+	// defaults are used when empty.
+	Ciphers []string
+
+	mu          sync.Mutex
+	hostKeyErr  error
+	keyRejected bool
+}
+
+// ClientConfig returns the SSH client config with the algorithms
+// restrictions.
+func (a *SSHAuth) ClientConfig() (*gossh.ClientConfig, error) {
+	config, err := a.PublicKeys.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.HostKeyAlgorithms = a.HostKeyAlgorithms
+	config.KeyExchanges = a.KexAlgorithms
+	config.Ciphers = a.Ciphers
+
+	callback := config.HostKeyCallback
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key gossh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		a.mu.Lock()
+		a.hostKeyErr = err
+		a.mu.Unlock()
+		return err
+	}
+
+	// the key is rejected unless the server accepts to verify its
+	// signature, the SSH client doesn't tell why the handshake failed
+	a.mu.Lock()
+	a.keyRejected = false
+	a.mu.Unlock()
+	signer := a.Signer
+	config.Auth = []gossh.AuthMethod{gossh.PublicKeysCallback(func() ([]gossh.Signer, error) {
+		a.mu.Lock()
+		a.keyRejected = true
+		a.mu.Unlock()
+		return []gossh.Signer{&acceptedSigner{Signer: signer, auth: a}}, nil
+	})}
+	return config, nil
+}
+
+// HostKeyError returns the error of the last host key verification, the
+// SSH client doesn't keep the error type when the handshake fails.
+func (a *SSHAuth) HostKeyError() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.hostKeyErr
+}
+
+// PublicKeyRejected returns if the server rejected the public key during
+// the last authentication.
+func (a *SSHAuth) PublicKeyRejected() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.keyRejected
+}
+
+// acceptedSigner records the public key as accepted once the server
+// asks for its signature.
+type acceptedSigner struct {
+	gossh.Signer
+	auth *SSHAuth
+}
+
+func (s *acceptedSigner) Sign(rand io.Reader, data []byte) (*gossh.Signature, error) {
+	s.auth.mu.Lock()
+	s.auth.keyRejected = false
+	s.auth.mu.Unlock()
+	return s.Signer.Sign(rand, data)
+}
+
+// IsHostKeyError returns if a git operation with the auth method failed
+// because the host key of the server could not be verified.
+func IsHostKeyError(auth transport.AuthMethod) bool {
+	a, ok := auth.(*SSHAuth)
+	return ok && a.HostKeyError() != nil
+}
+
+// AuthError returns the error of a git operation with the auth method,
+// telling when a bearer token was rejected by the server.
+func AuthError(auth transport.AuthMethod, err error) error {
+	if err == nil || !IsAuthError(auth, err) {
+		return err
+	}
+	if a, ok := auth.(*HTTPAuth); ok {
+		auth = a.AuthMethod
+	}
+	if _, ok := auth.(*http.TokenAuth); ok {
+		return fmt.Errorf("bearer token rejected, check that it is valid and can read the repository: %w", err)
+	}
+	return err
+}
+
+// IsAuthError returns if the error of a git operation with the auth
+// method is an authentication or authorization failure.
+func IsAuthError(auth transport.AuthMethod, err error) bool {
+	if err == nil {
+		return false
+	}
+	if a, ok := auth.(*SSHAuth); ok && a.PublicKeyRejected() {
+		return true
+	}
+	return errors.Is(err, transport.ErrAuthenticationRequired) ||
+		errors.Is(err, transport.ErrAuthorizationFailed)
 }
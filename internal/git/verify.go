@@ -0,0 +1,270 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// EmailAuthor binds the signing key to the commit author email.
+	EmailAuthor = "author"
+
+	// EmailCommitter binds the signing key to the commit committer email.
+	EmailCommitter = "committer"
+)
+
+// Verifier verifies the OpenPGP and SSH signatures of commits and tags.
+type Verifier struct {
+	// KeyRing holds the trusted PGP public keys.
+	KeyRing openpgp.EntityList
+
+	// AllowedSigners holds the trusted SSH public keys.
+	AllowedSigners []AllowedSigner
+
+	// RevokedKeys holds the SSH public keys that are no longer trusted.
+	RevokedKeys []ssh.PublicKey
+
+	// Email binds the signing key to the EmailAuthor or EmailCommitter
+	// email of the commits, the key must have a PGP identity or an SSH
+	// principal matching it. Tags are bound to the tagger email. Any
+	// trusted key can sign any commit when empty.
+	Email string
+}
+
+// Signer is the key a signature was verified with.
+type Signer struct {
+	// Fingerprint is the fingerprint of the signing key.
+	Fingerprint string
+
+	// Identity is the identity of the signer, the PGP key identity or the
+	// SSH allowed signer principal.
+	Identity string
+}
+
+// VerifyCommit verifies the signature of the commit, made by a trusted
+// key that was not expired when it signed and that is not revoked. The
+// PGP signatures record their creation time, SSH signatures do not and
+// the committer time is trusted instead, it is covered by the signature
+// but set by the signer. The verifier is picked from the signature header.
+func (v *Verifier) VerifyCommit(commit *object.Commit) (*Signer, error) {
+	if commit.PGPSignature == "" {
+		return nil, fmt.Errorf("signature not found for commit '%s'", commit.Hash)
+	}
+
+	var email string
+	switch v.Email {
+	case "":
+	case EmailAuthor:
+		email = commit.Author.Email
+	case EmailCommitter:
+		email = commit.Committer.Email
+	default:
+		return nil, fmt.Errorf("unsupported email binding '%s'", v.Email)
+	}
+
+	encoded := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(encoded); err != nil {
+		return nil, err
+	}
+	payload, err := readObject(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(commit.PGPSignature, "-----BEGIN "+sshSigType+"-----") {
+		signer, err := v.verifySSH(commit.PGPSignature, payload, email, commit.Committer.When)
+		if err != nil {
+			return nil, fmt.Errorf("SSH signature of '%s' for commit '%s' can't be verified: %w", commit.Author, commit.Hash, err)
+		}
+		return signer, nil
+	}
+
+	signer, err := v.verifyPGP(commit.PGPSignature, payload, email)
+	if err != nil {
+		return nil, fmt.Errorf("PGP signature of '%s' for commit '%s' can't be verified: %w", commit.Author, commit.Hash, err)
+	}
+	return signer, nil
+}
+
+// VerifyTag verifies the PGP signature of the annotated tag, made by a
+// trusted key that was not expired at the signature creation time and
+// that is not revoked, and returns the hash of the tag object. Lightweight tags have
+// no signature and fail verification.
+func (v *Verifier) VerifyTag(repo *git.Repository, name string) (*Signer, plumbing.Hash, error) {
+	ref, err := repo.Tag(name)
+	if err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("tag '%s' error: %w", name, err)
+	}
+	tag, err := repo.TagObject(ref.Hash())
+	if err == plumbing.ErrObjectNotFound {
+		return nil, plumbing.ZeroHash, fmt.Errorf("tag '%s' is a lightweight tag and can't be signed", name)
+	}
+	if err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("tag '%s' error: %w", name, err)
+	}
+	if tag.PGPSignature == "" {
+		return nil, plumbing.ZeroHash, fmt.Errorf("PGP signature not found for tag '%s'", name)
+	}
+
+	var email string
+	if v.Email != "" {
+		email = tag.Tagger.Email
+	}
+
+	encoded := &plumbing.MemoryObject{}
+	if err := tag.EncodeWithoutSignature(encoded); err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+	payload, err := readObject(encoded)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+
+	signer, err := v.verifyPGP(tag.PGPSignature, payload, email)
+	if err != nil {
+		return nil, plumbing.ZeroHash, fmt.Errorf("PGP signature of '%s' for tag '%s' can't be verified: %w", tag.Tagger, name, err)
+	}
+	return signer, tag.Hash, nil
+}
+
+// verifyPGP verifies the armored PGP signature of the message, made by a
+// key of the key ring bound to the email if not empty. The key and the
+// identity it is bound through must not be expired at the signature
+// creation time.
+func (v *Verifier) verifyPGP(armored string, message []byte, email string) (*Signer, error) {
+	block, err := armor.Decode(strings.NewReader(armored))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PGP signature armor: %w", err)
+	}
+	p, err := packet.Read(block.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PGP signature: %w", err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok || sig.IssuerKeyId == nil {
+		return nil, fmt.Errorf("unsupported PGP signature")
+	}
+
+	for _, key := range v.KeyRing.KeysById(*sig.IssuerKeyId) {
+		h := sig.Hash.New()
+		h.Write(message)
+		if err := key.PublicKey.VerifySignature(h, sig); err != nil {
+			continue
+		}
+
+		fingerprint := fmt.Sprintf("%X", key.PublicKey.Fingerprint)
+		when := sig.CreationTime
+		if pgpKeyRevoked(key) {
+			return nil, fmt.Errorf("key '%s' is revoked", fingerprint)
+		}
+		if key.PublicKey != key.Entity.PrimaryKey && pgpLifetimeExpired(key.PublicKey, key.SelfSignature, when) {
+			return nil, fmt.Errorf("subkey '%s' was expired at %s", fingerprint, when.UTC().Format(time.RFC3339))
+		}
+
+		// the identities bound to the email that were not expired, prefer
+		// the primary identity, then the first by name
+		signer := &Signer{Fingerprint: fingerprint}
+		var primary, expired bool
+		for _, identity := range key.Entity.Identities {
+			if email != "" && !strings.EqualFold(identity.UserId.Email, email) {
+				continue
+			}
+			if pgpLifetimeExpired(key.Entity.PrimaryKey, identity.SelfSignature, when) {
+				expired = true
+				continue
+			}
+			isPrimary := identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId
+			if signer.Identity == "" || (isPrimary && !primary) || (isPrimary == primary && identity.Name < signer.Identity) {
+				signer.Identity = identity.Name
+				primary = isPrimary
+			}
+		}
+		if signer.Identity == "" && expired {
+			return nil, fmt.Errorf("key '%s' was expired at %s", fingerprint, when.UTC().Format(time.RFC3339))
+		}
+		if signer.Identity == "" {
+			return nil, fmt.Errorf("key '%s' has no identity for '%s'", fingerprint, email)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("no trusted key with ID '%X'", *sig.IssuerKeyId)
+}
+
+// pgpKeyRevoked returns if the key or its primary key are revoked.
+func pgpKeyRevoked(key openpgp.Key) bool {
+	if len(key.Entity.Revocations) > 0 {
+		return true
+	}
+	return key.SelfSignature != nil &&
+		(key.SelfSignature.SigType == packet.SigTypeSubkeyRevocation || key.SelfSignature.RevocationReason != nil)
+}
+
+// pgpLifetimeExpired returns if the key lifetime of the self signature,
+// which counts from the key creation time, was over at the given time.
+func pgpLifetimeExpired(pub *packet.PublicKey, sig *packet.Signature, when time.Time) bool {
+	if sig == nil || sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		return false
+	}
+	return when.After(pub.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second))
+}
+
+// readObject reads the content of the encoded object.
+func readObject(obj plumbing.EncodedObject) ([]byte, error) {
+	r, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// CommitsSince returns the commits reachable from head that are not
+// reachable from any of the since commits, head first. Without since
+// commits, the whole history of head is returned. Head is always
+// returned, even when it is reachable from a since commit. It fails if a
+// since commit is not in the repository.
+func CommitsSince(repo *git.Repository, head plumbing.Hash, since ...plumbing.Hash) ([]*object.Commit, error) {
+	headCommit, err := repo.CommitObject(head)
+	if err != nil {
+		return nil, fmt.Errorf("commit '%s' error: %w", head, err)
+	}
+
+	// the commits reachable from since were verified before
+	verified := make(map[plumbing.Hash]bool)
+	for _, hash := range since {
+		sinceCommit, err := repo.CommitObject(hash)
+		if err != nil {
+			return nil, fmt.Errorf("commit '%s' not found in the history of '%s': %w", hash, head, err)
+		}
+		err = object.NewCommitPreorderIter(sinceCommit, verified, nil).ForEach(func(c *object.Commit) error {
+			verified[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if verified[head] {
+		return []*object.Commit{headCommit}, nil
+	}
+
+	var commits []*object.Commit
+	err = object.NewCommitPreorderIter(headCommit, verified, nil).ForEach(func(c *object.Commit) error {
+		commits = append(commits, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
@@ -0,0 +1,330 @@
+package git
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/ssh"
+)
+
+// testEntity returns a new PGP entity created age ago, whose key expires
+// after the lifetime if not zero.
+func testEntity(t *testing.T, name string, age, lifetime time.Duration) *openpgp.Entity {
+	created := time.Now().Add(-age)
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{Time: func() time.Time { return created }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifetime > 0 {
+		secs := uint32(lifetime.Seconds())
+		for id, identity := range entity.Identities {
+			identity.SelfSignature.KeyLifetimeSecs = &secs
+			if err := identity.SelfSignature.SignUserId(id, entity.PrimaryKey, entity.PrivateKey, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return entity
+}
+
+// testIdentity adds an identity to the entity, whose key expires after
+// the lifetime if not zero.
+func testIdentity(t *testing.T, entity *openpgp.Entity, name string, lifetime time.Duration) {
+	uid := packet.NewUserId(name, "", name+"@example.com")
+	sig := &packet.Signature{
+		CreationTime: entity.PrimaryKey.CreationTime,
+		SigType:      packet.SigTypePositiveCert,
+		PubKeyAlgo:   entity.PrimaryKey.PubKeyAlgo,
+		Hash:         crypto.SHA256,
+		IssuerKeyId:  &entity.PrimaryKey.KeyId,
+	}
+	if lifetime > 0 {
+		secs := uint32(lifetime.Seconds())
+		sig.KeyLifetimeSecs = &secs
+	}
+	if err := sig.SignUserId(uid.Id, entity.PrimaryKey, entity.PrivateKey, nil); err != nil {
+		t.Fatal(err)
+	}
+	entity.Identities[uid.Id] = &openpgp.Identity{Name: uid.Id, UserId: uid, SelfSignature: sig}
+}
+
+// testKeyRing returns the trusted key ring of the entities, read from
+// their armored public keys.
+func testKeyRing(t *testing.T, entities ...*openpgp.Entity) openpgp.EntityList {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entity := range entities {
+		if err := entity.Serialize(w); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	keyRing, err := openpgp.ReadArmoredKeyRing(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyRing
+}
+
+// testCommit commits an empty tree to the in-memory repository, signed
+// with the entity if not nil.
+func testCommit(t *testing.T, repo *git.Repository, msg string, author *object.Signature, entity *openpgp.Entity) plumbing.Hash {
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := w.Commit(msg, &git.CommitOptions{Author: author, SignKey: entity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+// testSSHCommit stores a commit of an empty tree signed with the SSH
+// signer, like git does with gpg.format=ssh.
+func testSSHCommit(t *testing.T, repo *git.Repository, msg string, author *object.Signature, signer ssh.Signer) plumbing.Hash {
+	commit := &object.Commit{
+		Author:    *author,
+		Committer: *author,
+		Message:   msg,
+		TreeHash:  plumbing.NewHash("4b825dc642cb6eb9a060e54bf8d69288fbee4904"),
+	}
+	encoded := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(encoded); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := readObject(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit.PGPSignature = testSSHSign(t, signer, payload, "git")
+
+	obj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestVerifier_VerifyCommit(t *testing.T) {
+	trusted := testEntity(t, "trusted", 0, 0)
+	untrusted := testEntity(t, "untrusted", 0, 0)
+	expiring := testEntity(t, "expiring", 0, time.Hour)
+	expired := testEntity(t, "expired", 2*time.Hour, time.Hour)
+	revoked := testEntity(t, "revoked", 0, 0)
+	// the renamed identity expired, the current one does not
+	renamed := testEntity(t, "renamed", 2*time.Hour, time.Hour)
+	testIdentity(t, renamed, "current", 0)
+	keyRing := testKeyRing(t, trusted, expiring, expired, revoked, renamed)
+	keyRing[3].Revocations = append(keyRing[3].Revocations, &packet.Signature{SigType: packet.SigTypeKeyRevocation})
+
+	sshTrusted := testSSHSigner(t)
+	sshUntrusted := testSSHSigner(t)
+	sshExpiring := testSSHSigner(t)
+	sshRevoked := testSSHSigner(t)
+	signers := []AllowedSigner{
+		{Principals: []string{"dev@example.com", "*@ops.example.com"}, Key: sshTrusted.PublicKey()},
+		{Principals: []string{"dev@example.com"}, ValidBefore: time.Now().Add(time.Hour), Key: sshExpiring.PublicKey()},
+		{Principals: []string{"dev@example.com"}, Key: sshRevoked.PublicKey()},
+	}
+
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		email        string
+		when         time.Duration
+		entity       *openpgp.Entity
+		sshSigner    ssh.Signer
+		bind         string
+		wantIdentity string
+		wantErr      bool
+	}{
+		{"trusted signature", "dev@example.com", 0, trusted, nil, "", "trusted <trusted@example.com>", false},
+		{"untrusted signature", "dev@example.com", 0, untrusted, nil, "", "", true},
+		{"unsigned", "dev@example.com", 0, nil, nil, "", "", true},
+		{"key not expired", "dev@example.com", 0, expiring, nil, "", "expiring <expiring@example.com>", false},
+		{"key not expired at the signature time", "dev@example.com", 2 * time.Hour, expiring, nil, "", "expiring <expiring@example.com>", false},
+		{"expired key", "dev@example.com", 0, expired, nil, "", "", true},
+		{"identity not expired", "dev@example.com", 0, renamed, nil, "", "current <current@example.com>", false},
+		{"bound identity not expired", "current@example.com", 0, renamed, nil, EmailAuthor, "current <current@example.com>", false},
+		{"bound identity expired", "renamed@example.com", 0, renamed, nil, EmailAuthor, "", true},
+		{"revoked key", "dev@example.com", 0, revoked, nil, "", "", true},
+		{"bound identity", "trusted@example.com", 0, trusted, nil, EmailAuthor, "trusted <trusted@example.com>", false},
+		{"unbound identity", "dev@example.com", 0, trusted, nil, EmailCommitter, "", true},
+		{"trusted SSH signature", "dev@example.com", 0, nil, sshTrusted, "", "dev@example.com", false},
+		{"untrusted SSH signature", "dev@example.com", 0, nil, sshUntrusted, "", "", true},
+		{"SSH key not expired", "dev@example.com", 0, nil, sshExpiring, "", "dev@example.com", false},
+		{"expired SSH key", "dev@example.com", 2 * time.Hour, nil, sshExpiring, "", "", true},
+		{"revoked SSH key", "dev@example.com", 0, nil, sshRevoked, "", "", true},
+		{"bound SSH principal pattern", "alice@ops.example.com", 0, nil, sshTrusted, EmailAuthor, "alice@ops.example.com", false},
+		{"unbound SSH principal", "alice@example.com", 0, nil, sshTrusted, EmailAuthor, "", true},
+		{"unsupported binding", "dev@example.com", 0, trusted, nil, "tagger", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			author := &object.Signature{Name: "dev", Email: tt.email, When: time.Now().Add(tt.when)}
+			var hash plumbing.Hash
+			if tt.sshSigner != nil {
+				hash = testSSHCommit(t, repo, tt.name, author, tt.sshSigner)
+			} else {
+				hash = testCommit(t, repo, tt.name, author, tt.entity)
+			}
+			commit, err := repo.CommitObject(hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v := &Verifier{
+				KeyRing:        keyRing,
+				AllowedSigners: signers,
+				RevokedKeys:    []ssh.PublicKey{sshRevoked.PublicKey()},
+				Email:          tt.bind,
+			}
+			signer, err := v.VerifyCommit(commit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyCommit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if signer.Identity != tt.wantIdentity {
+				t.Errorf("VerifyCommit() identity = %v, want %v", signer.Identity, tt.wantIdentity)
+			}
+			if signer.Fingerprint == "" {
+				t.Error("VerifyCommit() fingerprint is empty")
+			}
+		})
+	}
+}
+
+func TestVerifier_VerifyTag(t *testing.T) {
+	trusted := testEntity(t, "trusted", 0, 0)
+	untrusted := testEntity(t, "untrusted", 0, 0)
+
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := &object.Signature{Name: "release", Email: "trusted@example.com", When: time.Now()}
+	commit := testCommit(t, repo, "release", signature, nil)
+
+	tags := []struct {
+		name string
+		opts *git.CreateTagOptions
+	}{
+		{"trusted", &git.CreateTagOptions{Tagger: signature, Message: "trusted", SignKey: trusted}},
+		{"untrusted", &git.CreateTagOptions{Tagger: signature, Message: "untrusted", SignKey: untrusted}},
+		{"unsigned", &git.CreateTagOptions{Tagger: signature, Message: "unsigned"}},
+		{"lightweight", nil},
+	}
+	hashes := make(map[string]plumbing.Hash)
+	for _, tag := range tags {
+		ref, err := repo.CreateTag(tag.name, commit, tag.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[tag.name] = ref.Hash()
+	}
+
+	tests := []struct {
+		name    string
+		tag     string
+		bind    string
+		wantErr bool
+	}{
+		{"trusted signature", "trusted", "", false},
+		{"bound identity", "trusted", EmailCommitter, false},
+		{"untrusted signature", "untrusted", "", true},
+		{"unsigned", "unsigned", "", true},
+		{"lightweight", "lightweight", "", true},
+		{"missing", "missing", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Verifier{KeyRing: testKeyRing(t, trusted), Email: tt.bind}
+			signer, hash, err := v.VerifyTag(repo, tt.tag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyTag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if hash != hashes[tt.tag] {
+				t.Errorf("VerifyTag() hash = %v, want %v", hash, hashes[tt.tag])
+			}
+			if signer.Identity != "trusted <trusted@example.com>" {
+				t.Errorf("VerifyTag() identity = %v", signer.Identity)
+			}
+		})
+	}
+}
+
+func TestCommitsSince(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	author := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	first := testCommit(t, repo, "first", author, nil)
+	second := testCommit(t, repo, "second", author, nil)
+	third := testCommit(t, repo, "third", author, nil)
+	fourth := testCommit(t, repo, "fourth", author, nil)
+
+	tests := []struct {
+		name    string
+		head    plumbing.Hash
+		since   []plumbing.Hash
+		want    []plumbing.Hash
+		wantErr bool
+	}{
+		{"whole history", fourth, nil, []plumbing.Hash{fourth, third, second, first}, false},
+		{"same commit", fourth, []plumbing.Hash{fourth}, []plumbing.Hash{fourth}, false},
+		{"new commits", fourth, []plumbing.Hash{second}, []plumbing.Hash{fourth, third}, false},
+		{"head behind since", first, []plumbing.Hash{third}, []plumbing.Hash{first}, false},
+		{"nearest since", fourth, []plumbing.Hash{first, third}, []plumbing.Hash{fourth}, false},
+		{"missing since", fourth, []plumbing.Hash{plumbing.NewHash("0123456789012345678901234567890123456789")}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commits, err := CommitsSince(repo, tt.head, tt.since...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CommitsSince() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []plumbing.Hash
+			for _, c := range commits {
+				got = append(got, c.Hash)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("CommitsSince() got = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("CommitsSince() got = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package oci
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type dockerConfig struct {
+	Auths map[string]struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	} `json:"auths"`
+}
+
+// CredentialsFromSecret returns the username and password for the given
+// registry host, read from the '.dockerconfigjson' field of a
+// kubernetes.io/dockerconfigjson secret or from the 'username' and
+// 'password' fields.
+func CredentialsFromSecret(secret corev1.Secret, host string) (string, string, error) {
+	if data, ok := secret.Data[corev1.DockerConfigJsonKey]; ok {
+		return credentialsFromDockerConfig(secret.Name, data, host)
+	}
+
+	username, password := string(secret.Data["username"]), string(secret.Data["password"])
+	if username == "" || password == "" {
+		return "", "", fmt.Errorf("invalid '%s' secret data: required fields '%s' or 'username' and 'password'",
+			secret.Name, corev1.DockerConfigJsonKey)
+	}
+	return username, password, nil
+}
+
+func credentialsFromDockerConfig(name string, data []byte, host string) (string, string, error) {
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", "", fmt.Errorf("invalid '%s' secret data: unable to decode '%s': %w",
+			name, corev1.DockerConfigJsonKey, err)
+	}
+
+	for registry, auth := range config.Auths {
+		if registryHost(registry) != host {
+			continue
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return "", "", fmt.Errorf("invalid '%s' secret data: unable to decode auth for '%s': %w",
+					name, registry, err)
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				return "", "", fmt.Errorf("invalid '%s' secret data: malformed auth for '%s'", name, registry)
+			}
+			return parts[0], parts[1], nil
+		}
+		return auth.Username, auth.Password, nil
+	}
+	return "", "", fmt.Errorf("invalid '%s' secret data: no credentials found for '%s'", name, host)
+}
+
+// registryHost returns the host of a docker config registry key,
+// which can be a bare host or an URL like 'https://index.docker.io/v1/'.
+func registryHost(registry string) string {
+	if strings.Contains(registry, "://") {
+		if u, err := url.Parse(registry); err == nil {
+			registry = u.Host
+		}
+	}
+	registry = strings.SplitN(registry, "/", 2)[0]
+	if registry == "index.docker.io" {
+		return "registry-1.docker.io"
+	}
+	return registry
+}
@@ -0,0 +1,25 @@
+package oci
+
+import (
+	"fmt"
+)
+
+const (
+	// ChartLayerMediaType is the media type of a Helm chart layer.
+	ChartLayerMediaType = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+
+	// LegacyChartLayerMediaType is the media type of a Helm chart layer
+	// pushed by Helm versions before v3.7.
+	LegacyChartLayerMediaType = "application/tar+gzip"
+)
+
+// ChartLayer returns the Helm chart layer of the manifest.
+func ChartLayer(manifest *Manifest) (Descriptor, error) {
+	for _, layer := range manifest.Layers {
+		switch layer.MediaType {
+		case ChartLayerMediaType, LegacyChartLayerMediaType:
+			return layer, nil
+		}
+	}
+	return Descriptor{}, fmt.Errorf("no Helm chart layer found in manifest")
+}
@@ -0,0 +1,30 @@
+package oci
+
+import (
+	"testing"
+)
+
+func TestChartLayer(t *testing.T) {
+	tests := []struct {
+		name    string
+		layers  []Descriptor
+		want    string
+		wantErr bool
+	}{
+		{"chart layer", []Descriptor{{MediaType: "application/vnd.cncf.helm.chart.provenance.v1.prov"}, {MediaType: ChartLayerMediaType, Digest: "sha256:a"}}, "sha256:a", false},
+		{"legacy chart layer", []Descriptor{{MediaType: LegacyChartLayerMediaType, Digest: "sha256:b"}}, "sha256:b", false},
+		{"no chart layer", []Descriptor{{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ChartLayer(&Manifest{Layers: tt.layers})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ChartLayer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got.Digest != tt.want {
+				t.Errorf("ChartLayer() got = %v, want %v", got.Digest, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// OCIManifestMediaType is the media type of an OCI image manifest.
+	OCIManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+	// DockerManifestMediaType is the media type of a Docker image manifest.
+	DockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+
+	// DefaultMaxBlobSize is the maximum size of the blobs pulled by the
+	// clients with no MaxBlobSize set, 512MiB.
+	DefaultMaxBlobSize int64 = 512 << 20
+
+	// maxManifestSize is the maximum size of the manifests, 4MiB as
+	// accepted by the registries.
+	maxManifestSize int64 = 4 << 20
+
+	// defaultTimeout is the timeout of the requests of the default
+	// client, blob downloads included.
+	defaultTimeout = 60 * time.Second
+)
+
+// defaultClient is the HTTP client of the clients without one.
+var defaultClient = &http.Client{Timeout: defaultTimeout}
+
+// ErrUnauthorized is returned when the registry rejects the credentials.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Repository is the location of a repository in an OCI registry.
+type Repository struct {
+	// Host is the registry host with an optional port.
+	Host string
+
+	// Name is the repository name, e.g. 'org/app'.
+	Name string
+}
+
+// String returns the repository in the 'oci://<host>/<name>' format.
+func (r Repository) String() string {
+	return fmt.Sprintf("oci://%s/%s", r.Host, r.Name)
+}
+
+// ParseRepository parses an 'oci://<host>/<name>' URL.
+func ParseRepository(rawURL string) (Repository, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Repository{}, err
+	}
+	name := strings.Trim(u.Path, "/")
+	if u.Scheme != "oci" || u.Host == "" || name == "" {
+		return Repository{}, fmt.Errorf("invalid OCI repository URL '%s', expected format 'oci://<host>/<name>'", rawURL)
+	}
+	return Repository{Host: u.Host, Name: name}, nil
+}
+
+// Descriptor describes the content of a manifest or layer.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Layer returns the first layer with the given media type, or the
+// first layer of the manifest when the media type is empty.
+func (m *Manifest) Layer(mediaType string) (Descriptor, error) {
+	for _, layer := range m.Layers {
+		if mediaType == "" || layer.MediaType == mediaType {
+			return layer, nil
+		}
+	}
+	if mediaType == "" {
+		return Descriptor{}, fmt.Errorf("no layers found in manifest")
+	}
+	return Descriptor{}, fmt.Errorf("no layer with media type '%s' found in manifest", mediaType)
+}
+
+// Client is a minimal client for the OCI distribution API, able to
+// list tags and pull manifests and blobs. Registries asking for
+// Bearer token authentication are served with a token obtained from
+// their realm using the configured credentials.
+type Client struct {
+	HTTPClient *http.Client
+	Username   string
+	Password   string
+
+	// PlainHTTP makes the client talk HTTP instead of HTTPS.
+	PlainHTTP bool
+
+	// MaxBlobSize is the maximum size of the blobs pulled, defaults to
+	// DefaultMaxBlobSize.
+	MaxBlobSize int64
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient returns a client authenticating with the given
+// credentials, which may be empty for anonymous access.
+func NewClient(username, password string) *Client {
+	return &Client{
+		HTTPClient: defaultClient,
+		Username:   username,
+		Password:   password,
+	}
+}
+
+// Ping checks if the registry is reachable and accepts the credentials.
+func (c *Client) Ping(ctx context.Context, host string) error {
+	res, err := c.get(ctx, c.url(host, "/v2/"), "", "")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// Tags returns all the tags of the repository.
+func (c *Client) Tags(ctx context.Context, repo Repository) ([]string, error) {
+	var tags []string
+	u := c.url(repo.Host, fmt.Sprintf("/v2/%s/tags/list", repo.Name))
+	for u != "" {
+		res, err := c.get(ctx, u, pullScope(repo), "")
+		if err != nil {
+			return nil, err
+		}
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&list)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to decode tags list: %w", err)
+		}
+		tags = append(tags, list.Tags...)
+		u = nextLink(res.Request.URL, res.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+// Manifest returns the manifest and its digest for the given tag or
+// digest reference.
+func (c *Client) Manifest(ctx context.Context, repo Repository, reference string) (*Manifest, string, error) {
+	u := c.url(repo.Host, fmt.Sprintf("/v2/%s/manifests/%s", repo.Name, reference))
+	res, err := c.get(ctx, u, pullScope(repo), OCIManifestMediaType+", "+DockerManifestMediaType)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > maxManifestSize {
+		return nil, "", fmt.Errorf("manifest '%s' exceeds the maximum size of %d bytes", reference, maxManifestSize)
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	if strings.HasPrefix(reference, "sha256:") && reference != digest {
+		return nil, "", fmt.Errorf("manifest digest mismatch, expected '%s' got '%s'", reference, digest)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, "", fmt.Errorf("unable to decode manifest: %w", err)
+	}
+	return &manifest, digest, nil
+}
+
+// Blob writes the blob with the given digest to w, verifying the
+// content against the digest, and refusing blobs larger than the
+// maximum blob size.
+func (c *Client) Blob(ctx context.Context, repo Repository, digest string, w io.Writer) error {
+	if !strings.HasPrefix(digest, "sha256:") {
+		return fmt.Errorf("unsupported digest algorithm in '%s'", digest)
+	}
+	u := c.url(repo.Host, fmt.Sprintf("/v2/%s/blobs/%s", repo.Name, digest))
+	res, err := c.get(ctx, u, pullScope(repo), "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	maxSize := c.MaxBlobSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBlobSize
+	}
+	if res.ContentLength > maxSize {
+		return fmt.Errorf("blob '%s' exceeds the maximum size of %d bytes", digest, maxSize)
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return fmt.Errorf("unable to read blob '%s': %w", digest, err)
+	}
+	if n > maxSize {
+		return fmt.Errorf("blob '%s' exceeds the maximum size of %d bytes", digest, maxSize)
+	}
+	if got := fmt.Sprintf("sha256:%x", h.Sum(nil)); got != digest {
+		return fmt.Errorf("blob digest mismatch, expected '%s' got '%s'", digest, got)
+	}
+	return nil
+}
+
+// url returns the URL of the path on the registry host.
+func (c *Client) url(host, path string) string {
+	scheme := "https"
+	if c.PlainHTTP {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, host, path)
+}
+
+// get performs a GET request, answering the authentication challenge of
+// the host of the URL when needed.
+func (c *Client) get(ctx context.Context, u, scope, accept string) (*http.Response, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	host := parsed.Host
+
+	c.mu.Lock()
+	token := c.tokens[host+"/"+scope]
+	c.mu.Unlock()
+
+	res, err := c.do(ctx, u, accept, token)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+
+		token, err := c.authorize(ctx, challenge, scope)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		if c.tokens == nil {
+			c.tokens = make(map[string]string)
+		}
+		c.tokens[host+"/"+scope] = token
+		c.mu.Unlock()
+
+		res, err = c.do(ctx, u, accept, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		res.Body.Close()
+		return nil, fmt.Errorf("GET %s: %w", u, ErrUnauthorized)
+	case res.StatusCode != http.StatusOK:
+		res.Body.Close()
+		return nil, fmt.Errorf("GET %s: unexpected status code %d", u, res.StatusCode)
+	}
+	return res, nil
+}
+
+func (c *Client) do(ctx context.Context, u, accept, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = defaultClient
+	}
+	return httpClient.Do(req)
+}
+
+// authorize returns the Authorization header value answering the
+// given WWW-Authenticate challenge.
+func (c *Client) authorize(ctx context.Context, challenge, scope string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if c.Username == "" {
+			return "", ErrUnauthorized
+		}
+		return basicAuth(c.Username, c.Password), nil
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || params["realm"] == "" {
+			return "", fmt.Errorf("invalid bearer realm in challenge '%s'", challenge)
+		}
+		query := realm.Query()
+		if service := params["service"]; service != "" {
+			query.Set("service", service)
+		}
+		if scope != "" {
+			query.Set("scope", scope)
+		}
+		realm.RawQuery = query.Encode()
+
+		req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		req = req.WithContext(ctx)
+		if c.Username != "" {
+			req.Header.Set("Authorization", basicAuth(c.Username, c.Password))
+		}
+		httpClient := c.HTTPClient
+		if httpClient == nil {
+			httpClient = defaultClient
+		}
+		res, err := httpClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("token request to '%s' failed with status code %d: %w",
+				realm.Host, res.StatusCode, ErrUnauthorized)
+		}
+
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+			return "", fmt.Errorf("unable to decode token response: %w", err)
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		if token.Token == "" {
+			return "", fmt.Errorf("empty token returned by '%s'", realm.Host)
+		}
+		return "Bearer " + token.Token, nil
+	}
+	return "", fmt.Errorf("unsupported authentication challenge '%s'", challenge)
+}
+
+// parseChallenge parses a WWW-Authenticate header value, e.g.
+// 'Bearer realm="https://auth.docker.io/token",service="registry.docker.io"'.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	scheme := strings.ToLower(parts[0])
+	if len(parts) < 2 {
+		return scheme, params
+	}
+
+	rest := parts[1]
+	for rest != "" {
+		kv := strings.SplitN(rest, "=", 2)
+		if len(kv) != 2 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		rest = strings.TrimSpace(kv[1])
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params[key] = value
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return scheme, params
+}
+
+// nextLink returns the URL of the next page from a Link header value,
+// e.g. '</v2/app/tags/list?last=v1&n=100>; rel="next"', resolved against
+// the URL of the request.
+func nextLink(base *url.URL, link string) string {
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	u, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(u).String()
+}
+
+func pullScope(repo Repository) string {
+	return fmt.Sprintf("repository:%s:pull", repo.Name)
+}
+
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
@@ -0,0 +1,199 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/fluxcd/source-controller/internal/oci/ocitest"
+)
+
+func TestClient(t *testing.T) {
+	registry := ocitest.NewTLSRegistry("user", "pass")
+	defer registry.Close()
+
+	registry.Push("1.0.0", ChartLayerMediaType, []byte("chart-1.0.0"))
+	digest := registry.Push("1.1.0", ChartLayerMediaType, []byte("chart-1.1.0"))
+	repo := Repository{Host: registry.Host(), Name: "charts/podinfo"}
+
+	client := NewClient("user", "pass")
+	client.HTTPClient = registry.Client()
+
+	if err := client.Ping(context.TODO(), repo.Host); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+
+	tags, err := client.Tags(context.TODO(), repo)
+	if err != nil {
+		t.Fatalf("Tags() error = %v", err)
+	}
+	if strings.Join(tags, ",") != "1.0.0,1.1.0" {
+		t.Errorf("Tags() got = %v", tags)
+	}
+
+	manifest, gotDigest, err := client.Manifest(context.TODO(), repo, "1.1.0")
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+	if gotDigest != digest {
+		t.Errorf("Manifest() digest = %v, want %v", gotDigest, digest)
+	}
+
+	var buf bytes.Buffer
+	if err := client.Blob(context.TODO(), repo, manifest.Layers[0].Digest, &buf); err != nil {
+		t.Fatalf("Blob() error = %v", err)
+	}
+	if buf.String() != "chart-1.1.0" {
+		t.Errorf("Blob() got = %v", buf.String())
+	}
+
+	client.MaxBlobSize = 4
+	if err := client.Blob(context.TODO(), repo, manifest.Layers[0].Digest, &buf); err == nil {
+		t.Error("Blob() expected error for blob exceeding the maximum size")
+	}
+
+	if _, _, err := client.Manifest(context.TODO(), repo, "2.0.0"); err == nil {
+		t.Error("Manifest() expected error for missing tag")
+	}
+
+	anonymous := NewClient("", "")
+	anonymous.HTTPClient = registry.Client()
+	if _, err := anonymous.Tags(context.TODO(), repo); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Tags() error = %v, want %v", err, ErrUnauthorized)
+	}
+}
+
+func TestManifest_Layer(t *testing.T) {
+	manifest := &Manifest{Layers: []Descriptor{
+		{MediaType: "application/vnd.cncf.flux.config.v1+json", Digest: "sha256:a"},
+		{MediaType: "application/vnd.cncf.flux.content.v1.tar+gzip", Digest: "sha256:b"},
+	}}
+	tests := []struct {
+		name      string
+		mediaType string
+		want      string
+		wantErr   bool
+	}{
+		{"first layer", "", "sha256:a", false},
+		{"media type", "application/vnd.cncf.flux.content.v1.tar+gzip", "sha256:b", false},
+		{"missing media type", "application/tar+gzip", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := manifest.Layer(tt.mediaType)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Layer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got.Digest != tt.want {
+				t.Errorf("Layer() got = %v, want %v", got.Digest, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRepository(t *testing.T) {
+	tests := []struct {
+		url     string
+		want    Repository
+		wantErr bool
+	}{
+		{"oci://ghcr.io/org/charts/podinfo", Repository{Host: "ghcr.io", Name: "org/charts/podinfo"}, false},
+		{"oci://localhost:5000/podinfo/", Repository{Host: "localhost:5000", Name: "podinfo"}, false},
+		{"https://ghcr.io/org/podinfo", Repository{}, true},
+		{"oci://ghcr.io", Repository{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := ParseRepository(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseRepository() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseRepository() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCredentialsFromSecret(t *testing.T) {
+	dockerConfig := `{"auths":{"https://index.docker.io/v1/":{"auth":"dXNlcjpwYXNz"},"ghcr.io":{"username":"gh","password":"token"}}}`
+	tests := []struct {
+		name         string
+		secret       corev1.Secret
+		host         string
+		wantUsername string
+		wantPassword string
+		wantErr      bool
+	}{
+		{"docker config auth", corev1.Secret{Data: map[string][]byte{".dockerconfigjson": []byte(dockerConfig)}},
+			"registry-1.docker.io", "user", "pass", false},
+		{"docker config username and password", corev1.Secret{Data: map[string][]byte{".dockerconfigjson": []byte(dockerConfig)}},
+			"ghcr.io", "gh", "token", false},
+		{"docker config without host", corev1.Secret{Data: map[string][]byte{".dockerconfigjson": []byte(dockerConfig)}},
+			"quay.io", "", "", true},
+		{"invalid docker config", corev1.Secret{Data: map[string][]byte{".dockerconfigjson": []byte("{")}},
+			"ghcr.io", "", "", true},
+		{"username and password", corev1.Secret{Data: map[string][]byte{"username": []byte("user"), "password": []byte("pass")}},
+			"ghcr.io", "user", "pass", false},
+		{"empty", corev1.Secret{}, "ghcr.io", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			username, password, err := CredentialsFromSecret(tt.secret, tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CredentialsFromSecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if username != tt.wantUsername || password != tt.wantPassword {
+				t.Errorf("CredentialsFromSecret() got = %v:%v, want %v:%v", username, password, tt.wantUsername, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	base, err := url.Parse("https://registry.example.com/v2/app/tags/list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		link string
+		want string
+	}{
+		{`</v2/app/tags/list?last=v1&n=100>; rel="next"`, "https://registry.example.com/v2/app/tags/list?last=v1&n=100"},
+		{`<https://cdn.example.com/v2/app/tags/list?last=v1>; rel="next"`, "https://cdn.example.com/v2/app/tags/list?last=v1"},
+		{`</v2/app/tags/list?last=v1&n=100>; rel="prev"`, ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			if got := nextLink(base, tt.link); got != tt.want {
+				t.Errorf("nextLink() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:org/app:pull,push"`)
+	if scheme != "bearer" {
+		t.Errorf("parseChallenge() scheme = %v", scheme)
+	}
+	want := map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:org/app:pull,push",
+	}
+	for k, v := range want {
+		if params[k] != v {
+			t.Errorf("parseChallenge() %s = %v, want %v", k, params[k], v)
+		}
+	}
+}
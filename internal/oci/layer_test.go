@@ -0,0 +1,53 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func TestVerifyTarGzip(t *testing.T) {
+	var tarball bytes.Buffer
+	zw := gzip.NewWriter(&tarball)
+	tw := tar.NewWriter(zw)
+	if err := tw.WriteHeader(&tar.Header{Name: "app.yaml", Mode: 0644, Size: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("kind")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var gzipped bytes.Buffer
+	zw = gzip.NewWriter(&gzipped)
+	if _, err := zw.Write([]byte("not a tarball, just some gzip compressed text")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"tarball", tarball.Bytes(), false},
+		{"truncated tarball", tarball.Bytes()[:tarball.Len()/2], true},
+		{"gzip without tarball", gzipped.Bytes(), true},
+		{"JSON", []byte(`{"kind":"config"}`), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyTarGzip(bytes.NewReader(tt.data)); (err != nil) != tt.wantErr {
+				t.Errorf("VerifyTarGzip() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
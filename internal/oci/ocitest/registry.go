@@ -0,0 +1,168 @@
+// Package ocitest provides an in-memory OCI registry, for testing the
+// clients of the oci package.
+package ocitest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const manifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+// Registry serves the distribution API with Bearer token
+// authentication, the tokens are issued for the basic auth
+// credentials of the registry.
+type Registry struct {
+	*httptest.Server
+
+	username string
+	password string
+
+	mu        sync.Mutex
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	tags      map[string]string
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+// NewRegistry starts a plain HTTP registry for the credentials. The
+// caller closes the registry.
+func NewRegistry(username, password string) *Registry {
+	r := newRegistry(username, password)
+	r.Server = httptest.NewServer(r.handler())
+	return r
+}
+
+// NewTLSRegistry starts a HTTPS registry for the credentials, the
+// client of the server trusts its certificate. The caller closes the
+// registry.
+func NewTLSRegistry(username, password string) *Registry {
+	r := newRegistry(username, password)
+	r.Server = httptest.NewTLSServer(r.handler())
+	return r
+}
+
+func newRegistry(username, password string) *Registry {
+	return &Registry{
+		username:  username,
+		password:  password,
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+		tags:      map[string]string{},
+	}
+}
+
+func (r *Registry) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		if user, pass, ok := req.BasicAuth(); !ok || user != r.username || pass != r.password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "token-" + req.URL.Query().Get("scope")})
+	})
+	mux.HandleFunc("/v2/", r.serveDistribution)
+	return mux
+}
+
+// Host returns the host and port of the registry.
+func (r *Registry) Host() string {
+	u, _ := url.Parse(r.URL)
+	return u.Host
+}
+
+// Push stores a manifest with the layers of the media type, and tags
+// it. It returns the digest of the manifest.
+func (r *Registry) Push(tag, mediaType string, layers ...[]byte) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := manifest{SchemaVersion: 2, MediaType: manifestMediaType}
+	for _, layer := range layers {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(layer))
+		r.blobs[digest] = layer
+		m.Layers = append(m.Layers, descriptor{
+			MediaType: mediaType,
+			Digest:    digest,
+			Size:      int64(len(layer)),
+		})
+	}
+	data, _ := json.Marshal(m)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	r.manifests[digest] = data
+	r.tags[tag] = digest
+	return digest
+}
+
+func (r *Registry) serveDistribution(w http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "Bearer token-") {
+		w.Header().Set("WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="%s/token",service="test-registry"`, r.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case path == "":
+		w.WriteHeader(http.StatusOK)
+	case strings.HasSuffix(path, "/tags/list"):
+		var tags []string
+		for tag := range r.tags {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		// serve one tag per page to exercise pagination
+		start := 0
+		if last := req.URL.Query().Get("last"); last != "" {
+			start = sort.SearchStrings(tags, last) + 1
+		}
+		if start+1 < len(tags) {
+			w.Header().Set("Link", fmt.Sprintf(`</v2/%s?last=%s&n=1>; rel="next"`, path, tags[start]))
+		}
+		_ = json.NewEncoder(w).Encode(map[string][]string{"tags": tags[start : start+1]})
+	case strings.Contains(path, "/manifests/"):
+		ref := path[strings.LastIndex(path, "/")+1:]
+		if digest, ok := r.tags[ref]; ok {
+			ref = digest
+		}
+		data, ok := r.manifests[ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", manifestMediaType)
+		_, _ = w.Write(data)
+	case strings.Contains(path, "/blobs/"):
+		data, ok := r.blobs[path[strings.LastIndex(path, "/")+1:]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,41 @@
+package oci
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// LatestTag returns the tag of the latest version matching the semver
+// constraint, an empty constraint matches any version.
+// Tags that are not a valid semver are ignored. As '+' is not allowed
+// in OCI tags, the build metadata separator is expected to be '_'.
+func LatestTag(tags []string, constraint string) (string, error) {
+	if constraint == "" {
+		constraint = "*"
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", fmt.Errorf("invalid version constraint '%s': %w", constraint, err)
+	}
+
+	versions := make(map[*semver.Version]string)
+	var matches []*semver.Version
+	for _, tag := range tags {
+		v, err := semver.NewVersion(strings.Replace(tag, "_", "+", 1))
+		if err != nil {
+			continue
+		}
+		if c.Check(v) {
+			versions[v] = tag
+			matches = append(matches, v)
+		}
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no tag matching version '%s' found", constraint)
+	}
+	sort.Sort(semver.Collection(matches))
+	return versions[matches[len(matches)-1]], nil
+}
@@ -0,0 +1,35 @@
+package oci
+
+import (
+	"testing"
+)
+
+func TestLatestTag(t *testing.T) {
+	tags := []string{"latest", "0.1.0", "1.0.0", "1.1.0", "1.2.0-rc.1", "1.1.1_build.5", "2.0.0"}
+	tests := []struct {
+		name       string
+		constraint string
+		want       string
+		wantErr    bool
+	}{
+		{"latest", "", "2.0.0", false},
+		{"exact", "1.0.0", "1.0.0", false},
+		{"range", "<2.0.0", "1.1.1_build.5", false},
+		{"tilde", "~0.1", "0.1.0", false},
+		{"prerelease", "~1.2.0-0", "1.2.0-rc.1", false},
+		{"no match", ">3.0.0", "", true},
+		{"invalid", "not-a-version", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LatestTag(tags, tt.constraint)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LatestTag() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("LatestTag() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
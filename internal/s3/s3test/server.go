@@ -0,0 +1,130 @@
+// Package s3test provides an in-memory stand-in for a S3 compatible
+// server, for testing the clients of the s3 package.
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Server serves a single bucket with path-style addressing, the
+// requests must be signed with the access key.
+type Server struct {
+	*httptest.Server
+
+	bucket    string
+	accessKey string
+	pageSize  int
+
+	mu        sync.Mutex
+	objects   map[string]string
+	downloads int
+}
+
+type object struct {
+	Key  string `xml:"Key"`
+	ETag string `xml:"ETag"`
+	Size int64  `xml:"Size"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Contents              []object `xml:"Contents"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken,omitempty"`
+}
+
+// NewServer starts a server for the bucket, listing pageSize objects
+// per page. The caller closes the server.
+func NewServer(bucket, accessKey string, pageSize int) *Server {
+	s := &Server{
+		bucket:    bucket,
+		accessKey: accessKey,
+		pageSize:  pageSize,
+		objects:   map[string]string{},
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Endpoint returns the host and port of the server.
+func (s *Server) Endpoint() string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
+
+// PutObject stores the content at the key, its ETag is the MD5 of
+// the content.
+func (s *Server) PutObject(key, content string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = content
+}
+
+// Downloads returns the number of objects served.
+func (s *Server) Downloads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.downloads
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/") {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/"+s.bucket)
+	if path == "" {
+		s.list(w, r.URL.Query())
+		return
+	}
+	content, ok := s.objects[strings.TrimPrefix(path, "/")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+		return
+	}
+	s.downloads++
+	fmt.Fprint(w, content)
+}
+
+func (s *Server) list(w http.ResponseWriter, query url.Values) {
+	var keys []string
+	for k := range s.objects {
+		if strings.HasPrefix(k, query.Get("prefix")) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if token := query.Get("continuation-token"); token != "" {
+		fmt.Sscanf(token, "%d", &start)
+	}
+	var result listBucketResult
+	for i := start; i < len(keys) && i < start+s.pageSize; i++ {
+		content := s.objects[keys[i]]
+		result.Contents = append(result.Contents, object{
+			Key:  keys[i],
+			ETag: fmt.Sprintf(`"%x"`, md5.Sum([]byte(content))),
+			Size: int64(len(content)),
+		})
+	}
+	if start+s.pageSize < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = fmt.Sprintf("%d", start+s.pageSize)
+	}
+	_ = xml.NewEncoder(w).Encode(result)
+}
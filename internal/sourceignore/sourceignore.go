@@ -0,0 +1,54 @@
+package sourceignore
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+const (
+	// IgnoreFile is the name of the file holding the ignore patterns
+	// of a source, read from the source root.
+	IgnoreFile = ".sourceignore"
+
+	// DefaultIgnore holds the patterns applied when a source does not
+	// specify its own.
+	DefaultIgnore = "*.jpg\n*.jpeg\n*.gif\n*.png\n*.wmv\n*.flv\n*.tar.gz\n*.zip\n"
+)
+
+// ReadPatterns parses the gitignore formatted patterns read from r,
+// skipping blank lines and comments.
+func ReadPatterns(r io.Reader, domain []string) []gitignore.Pattern {
+	var ps []gitignore.Pattern
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		s := scanner.Text()
+		if strings.TrimSpace(s) == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		ps = append(ps, gitignore.ParsePattern(s, domain))
+	}
+	return ps
+}
+
+// ReadIgnoreFile reads the patterns of the ignore file at path,
+// a missing file results in no patterns.
+func ReadIgnoreFile(path string, domain []string) ([]gitignore.Pattern, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return ReadPatterns(f, domain), nil
+}
+
+// DefaultPatterns returns the patterns of DefaultIgnore.
+func DefaultPatterns() []gitignore.Pattern {
+	return ReadPatterns(strings.NewReader(DefaultIgnore), nil)
+}
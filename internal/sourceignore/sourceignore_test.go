@@ -0,0 +1,79 @@
+package sourceignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+func TestReadPatterns(t *testing.T) {
+	patterns := `# comment
+*.png
+
+/docs/
+**/testdata
+`
+	m := gitignore.NewMatcher(ReadPatterns(strings.NewReader(patterns), nil))
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"logo.png", false, true},
+		{"assets/logo.png", false, true},
+		{"docs", true, true},
+		{"api/docs", true, false},
+		{"pkg/testdata", true, true},
+		{"deploy/app.yaml", false, false},
+		{"# comment", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := m.Match(strings.Split(tt.path, "/"), tt.isDir); got != tt.want {
+				t.Errorf("Match(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadIgnoreFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "sourceignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	ps, err := ReadIgnoreFile(filepath.Join(tmp, IgnoreFile), nil)
+	if err != nil || ps != nil {
+		t.Errorf("ReadIgnoreFile() of missing file = %v, %v", ps, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(tmp, IgnoreFile), []byte("charts/\n*.md\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ps, err = ReadIgnoreFile(filepath.Join(tmp, IgnoreFile), nil)
+	if err != nil {
+		t.Fatalf("ReadIgnoreFile() error = %v", err)
+	}
+	if len(ps) != 2 {
+		t.Errorf("ReadIgnoreFile() got %d patterns, want 2", len(ps))
+	}
+}
+
+func TestDefaultPatterns(t *testing.T) {
+	m := gitignore.NewMatcher(DefaultPatterns())
+	for path, want := range map[string]bool{
+		"img/logo.png":          true,
+		"release.tar.gz":        true,
+		"deploy/app.yaml":       false,
+		"charts/app/Chart.yaml": false,
+	} {
+		if got := m.Match(strings.Split(path, "/"), false); got != want {
+			t.Errorf("Match(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package symlink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Eval returns the path with its symlinks evaluated as the kernel would
+// follow them. Unlike filepath.EvalSymlinks it accepts missing paths, the
+// missing elements, including those of dangling links, are appended to
+// their existing parent.
+func Eval(path string) (string, error) {
+	var missing []string
+	for links := 0; ; {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent, base, ok := split(path)
+		if !ok {
+			return "", err
+		}
+		// a dangling link is resolved through its target
+		if link, lerr := os.Readlink(path); lerr == nil {
+			if links++; links > 255 {
+				return "", fmt.Errorf("too many links in '%s'", path)
+			}
+			if !filepath.IsAbs(link) {
+				link = parent + string(filepath.Separator) + link
+			}
+			path = link
+			continue
+		}
+		missing = append([]string{base}, missing...)
+		path = parent
+	}
+}
+
+// split splits the last element of the absolute path without cleaning
+// it, as the elements before '..' may be links.
+func split(path string) (parent, base string, ok bool) {
+	i := strings.LastIndex(path, string(filepath.Separator))
+	if i < 0 || path == string(filepath.Separator) {
+		return "", "", false
+	}
+	if parent = path[:i]; parent == "" {
+		parent = string(filepath.Separator)
+	}
+	return parent, path[i+1:], true
+}
+
+// Within reports whether the clean absolute path is dir or under it.
+func Within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,79 @@
+package symlink
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "symlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if tmp, err = filepath.EvalSymlinks(tmp); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(tmp, "dir")
+	if err := os.MkdirAll(filepath.Join(dir, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{
+		"a/up":     "..",
+		"b":        "a/up/..",
+		"self":     ".",
+		"dangling": "self/../missing",
+		"inside":   "a/missing",
+		"a/next":   "../../next",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"a", filepath.Join(dir, "a")},
+		{"a/up", dir},
+		{"a/up/missing/file", filepath.Join(dir, "missing/file")},
+		{"b", tmp},
+		{"dangling", filepath.Join(tmp, "missing")},
+		{"inside", filepath.Join(dir, "a/missing")},
+		{"self/../dir/a/next", filepath.Join(tmp, "next")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := Eval(dir + string(filepath.Separator) + tt.path)
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithin(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/tmp/dir", true},
+		{"/tmp/dir/file", true},
+		{"/tmp/dir2", false},
+		{"/tmp", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := Within("/tmp/dir", tt.path); got != tt.want {
+				t.Errorf("Within() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
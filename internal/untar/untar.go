@@ -0,0 +1,130 @@
+package untar
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/fluxcd/source-controller/internal/symlink"
+)
+
+// Untar extracts the gzip compressed tarball read from r into dir,
+// refusing entries that would be written outside of dir, including
+// through the symlinks of the tarball or those already present in dir.
+func Untar(r io.Reader, dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return err
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("requires gzip-compressed body: %w", err)
+	}
+	tr := tar.NewReader(zr)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("tar error: %w", err)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !symlink.Within(dir, target) {
+			return fmt.Errorf("tar entry '%s' is outside of the target directory", header.Name)
+		}
+		if target == dir {
+			continue
+		}
+
+		// the parent may be reached through the symlinks extracted so far,
+		// write the entry in its resolved location
+		parent, err := symlink.Eval(filepath.Dir(target))
+		if err != nil {
+			return err
+		}
+		if !symlink.Within(dir, parent) {
+			return fmt.Errorf("tar entry '%s' is outside of the target directory", header.Name)
+		}
+		target = filepath.Join(parent, filepath.Base(target))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, os.FileMode(header.Mode).Perm()|0600, tr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			link := header.Linkname
+			if !filepath.IsAbs(link) {
+				link = parent + string(filepath.Separator) + link
+			}
+			if link, err = symlink.Eval(link); err != nil {
+				return err
+			}
+			if !symlink.Within(dir, link) {
+				return fmt.Errorf("tar entry '%s' links outside of the target directory", header.Name)
+			}
+			if err := os.MkdirAll(parent, 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+
+	// links to missing paths are resolved against the entries extracted
+	// after them, verify none of them leads outside of dir
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return err
+		}
+		link, err := symlink.Eval(path)
+		if err != nil {
+			return err
+		}
+		if !symlink.Within(dir, link) {
+			rel, _ := filepath.Rel(dir, path)
+			return fmt.Errorf("tar entry '%s' links outside of the target directory", filepath.ToSlash(rel))
+		}
+		return nil
+	})
+}
+
+// writeFile writes the file, replacing the existing entry at path rather
+// than writing through it when it is a symlink.
+func writeFile(path string, mode os.FileMode, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
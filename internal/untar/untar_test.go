@@ -0,0 +1,152 @@
+package untar
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type entry struct {
+	name     string
+	typeflag byte
+	body     string
+	linkname string
+}
+
+func tarball(t *testing.T, entries []entry) *bytes.Buffer {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		header := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Mode:     0644,
+			Size:     int64(len(e.body)),
+			Linkname: e.linkname,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestUntar(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []entry
+		wantFile string
+		wantErr  bool
+	}{
+		{"files and dirs", []entry{
+			{name: "./charts/", typeflag: tar.TypeDir},
+			{name: "./charts/podinfo/Chart.yaml", typeflag: tar.TypeReg, body: "name: podinfo"},
+		}, "charts/podinfo/Chart.yaml", false},
+		{"symlink inside", []entry{
+			{name: "values.yaml", typeflag: tar.TypeReg, body: "replicas: 1"},
+			{name: "link.yaml", typeflag: tar.TypeSymlink, linkname: "values.yaml"},
+		}, "link.yaml", false},
+		{"path traversal", []entry{
+			{name: "../evil.yaml", typeflag: tar.TypeReg, body: "evil"},
+		}, "", true},
+		{"symlink outside", []entry{
+			{name: "passwd", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+		}, "", true},
+		{"chained symlinks", []entry{
+			{name: "a/", typeflag: tar.TypeDir},
+			{name: "a/up", typeflag: tar.TypeSymlink, linkname: ".."},
+			{name: "a/up/up2", typeflag: tar.TypeSymlink, linkname: ".."},
+			{name: "a/up/up2/pwned", typeflag: tar.TypeReg, body: "evil"},
+		}, "", true},
+		{"symlink through symlink", []entry{
+			{name: "a/", typeflag: tar.TypeDir},
+			{name: "a/up", typeflag: tar.TypeSymlink, linkname: ".."},
+			{name: "b", typeflag: tar.TypeSymlink, linkname: "a/up/.."},
+			{name: "b/pwned", typeflag: tar.TypeReg, body: "evil"},
+		}, "", true},
+		{"symlink resolved by a later entry", []entry{
+			{name: "l", typeflag: tar.TypeSymlink, linkname: "x/.."},
+			{name: "x", typeflag: tar.TypeSymlink, linkname: "."},
+		}, "", true},
+		{"dangling symlink resolved by a later entry", []entry{
+			{name: "l", typeflag: tar.TypeSymlink, linkname: "x/../missing"},
+			{name: "x", typeflag: tar.TypeSymlink, linkname: "."},
+		}, "", true},
+		{"file replacing symlink", []entry{
+			{name: "values.yaml", typeflag: tar.TypeReg, body: "replicas: 1"},
+			{name: "link.yaml", typeflag: tar.TypeSymlink, linkname: "values.yaml"},
+			{name: "link.yaml", typeflag: tar.TypeReg, body: "replicas: 2"},
+		}, "link.yaml", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "untar")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			dir := filepath.Join(tmp, "dir")
+			err = Untar(tarball(t, tt.entries), dir)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Untar() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantFile != "" {
+				if _, err := os.Stat(filepath.Join(dir, tt.wantFile)); err != nil {
+					t.Errorf("Untar() expected file %s: %v", tt.wantFile, err)
+				}
+			}
+			if files, _ := ioutil.ReadDir(tmp); len(files) != 1 {
+				t.Errorf("Untar() wrote %d entries outside of the target directory", len(files)-1)
+			}
+		})
+	}
+}
+
+func TestUntar_existingSymlink(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	outside := filepath.Join(tmp, "outside.yaml")
+	if err := ioutil.WriteFile(outside, []byte("replicas: 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(tmp, "dir")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "values.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = Untar(tarball(t, []entry{
+		{name: "values.yaml", typeflag: tar.TypeReg, body: "replicas: 2"},
+	}), dir)
+	if err != nil {
+		t.Fatalf("Untar() error = %v", err)
+	}
+	if b, _ := ioutil.ReadFile(outside); string(b) != "replicas: 1" {
+		t.Errorf("Untar() wrote through the symlink: %s", b)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "values.yaml")); string(b) != "replicas: 2" {
+		t.Errorf("Untar() values.yaml = %s, want replicas: 2", b)
+	}
+}
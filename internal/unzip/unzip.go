@@ -0,0 +1,66 @@
+package unzip
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Unzip extracts the zip archive read from r into dir, refusing
+// entries that would be written outside of dir. Entries other than
+// regular files and directories are skipped.
+func Unzip(r io.ReaderAt, size int64, dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("requires zip archive body: %w", err)
+	}
+
+	for _, f := range zr.File {
+		target := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+			return fmt.Errorf("zip entry '%s' is outside of the target directory", f.Name)
+		}
+
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			if err := writeFile(target, mode.Perm()|0600, f); err != nil {
+				return fmt.Errorf("zip entry '%s' error: %w", f.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, mode os.FileMode, f *zip.File) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,86 @@
+package unzip
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type entry struct {
+	name string
+	mode os.FileMode
+	body string
+}
+
+func archive(t *testing.T, entries []entry) *bytes.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		header.SetMode(e.mode)
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestUnzip(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []entry
+		wantFile string
+		noFile   string
+		wantErr  bool
+	}{
+		{"files and dirs", []entry{
+			{name: "manifests/", mode: os.ModeDir | 0755},
+			{name: "manifests/deployment.yaml", mode: 0644, body: "kind: Deployment"},
+		}, "manifests/deployment.yaml", "", false},
+		{"implicit dirs", []entry{
+			{name: "charts/podinfo/Chart.yaml", mode: 0644, body: "name: podinfo"},
+		}, "charts/podinfo/Chart.yaml", "", false},
+		{"symlink skipped", []entry{
+			{name: "passwd", mode: os.ModeSymlink | 0777, body: "/etc/passwd"},
+		}, "", "passwd", false},
+		{"path traversal", []entry{
+			{name: "../evil.yaml", mode: 0644, body: "evil"},
+		}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "unzip")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			r := archive(t, tt.entries)
+			err = Unzip(r, r.Size(), tmp)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unzip() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantFile != "" {
+				if _, err := os.Stat(filepath.Join(tmp, tt.wantFile)); err != nil {
+					t.Errorf("Unzip() expected file %s: %v", tt.wantFile, err)
+				}
+			}
+			if tt.noFile != "" {
+				if _, err := os.Lstat(filepath.Join(tmp, tt.noFile)); !os.IsNotExist(err) {
+					t.Errorf("Unzip() unexpected file %s", tt.noFile)
+				}
+			}
+		})
+	}
+}
@@ -35,9 +35,14 @@ import (
 
 	sourcev1 "github.com/fluxcd/source-controller/api/v1alpha1"
 	"github.com/fluxcd/source-controller/controllers"
+	intgit "github.com/fluxcd/source-controller/internal/git"
 	// +kubebuilder:scaffold:imports
 )
 
+// gitCacheDir is the directory of the Git clone cache in the storage path,
+// it is not served by the file server.
+const gitCacheDir = ".gitcache"
+
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
@@ -61,12 +66,19 @@ func main() {
 	var enableLeaderElection bool
 	var storagePath string
 	var storageAddr string
+	var gitCacheMaxSize int64
+	var gitCacheGCInterval time.Duration
 	flag.StringVar(&metricsAddr, "metrics-addr", ":9090", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&storagePath, "storage-path", "", "The local storage path.")
 	flag.StringVar(&storageAddr, "storage-addr", ":8080", "The address the static file server binds to.")
+	flag.Int64Var(&gitCacheMaxSize, "git-cache-max-size", 0,
+		"The maximum size in bytes of the Git clone cache kept in the storage path. "+
+			"The cache is disabled when set to zero.")
+	flag.DurationVar(&gitCacheGCInterval, "git-cache-gc-interval", 5*time.Minute,
+		"The interval at which the least recently used clones are evicted from the Git clone cache.")
 
 	flag.Parse()
 
@@ -88,11 +100,22 @@ func main() {
 
 	go startFileServer(storage.BasePath, storageAddr, setupLog)
 
+	var gitCache *intgit.Cache
+	if gitCacheMaxSize > 0 {
+		gitCache, err = intgit.NewCache(filepath.Join(storage.BasePath, gitCacheDir), gitCacheMaxSize)
+		if err != nil {
+			setupLog.Error(err, "unable to initialise Git cache")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.GitRepositoryReconciler{
-		Client:  mgr.GetClient(),
-		Log:     ctrl.Log.WithName("controllers").WithName("GitRepository"),
-		Scheme:  mgr.GetScheme(),
-		Storage: storage,
+		Client:             mgr.GetClient(),
+		Log:                ctrl.Log.WithName("controllers").WithName("GitRepository"),
+		Scheme:             mgr.GetScheme(),
+		Storage:            storage,
+		GitCache:           gitCache,
+		GitCacheGCInterval: gitCacheGCInterval,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "GitRepository")
 		os.Exit(1)
@@ -117,6 +140,33 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "HelmChart")
 		os.Exit(1)
 	}
+	if err = (&controllers.BucketReconciler{
+		Client:  mgr.GetClient(),
+		Log:     ctrl.Log.WithName("controllers").WithName("Bucket"),
+		Scheme:  mgr.GetScheme(),
+		Storage: storage,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Bucket")
+		os.Exit(1)
+	}
+	if err = (&controllers.OCIRepositoryReconciler{
+		Client:  mgr.GetClient(),
+		Log:     ctrl.Log.WithName("controllers").WithName("OCIRepository"),
+		Scheme:  mgr.GetScheme(),
+		Storage: storage,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "OCIRepository")
+		os.Exit(1)
+	}
+	if err = (&controllers.HTTPArchiveReconciler{
+		Client:  mgr.GetClient(),
+		Log:     ctrl.Log.WithName("controllers").WithName("HTTPArchive"),
+		Scheme:  mgr.GetScheme(),
+		Storage: storage,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "HTTPArchive")
+		os.Exit(1)
+	}
 	// +kubebuilder:scaffold:builder
 
 	setupLog.Info("starting manager")
@@ -128,13 +178,27 @@ func main() {
 
 func startFileServer(path string, address string, l logr.Logger) {
 	fs := http.FileServer(http.Dir(path))
-	http.Handle("/", fs)
+	http.Handle("/", hideDotFiles(fs))
 	err := http.ListenAndServe(address, nil)
 	if err != nil {
 		l.Error(err, "file server error")
 	}
 }
 
+// hideDotFiles prevents serving the files and directories starting
+// with a dot, like the Git cache.
+func hideDotFiles(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, part := range strings.Split(r.URL.Path, "/") {
+			if strings.HasPrefix(part, ".") {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 func mustInitStorage(path string, storageAddr string, l logr.Logger) *controllers.Storage {
 	if path == "" {
 		p, _ := os.Getwd()